@@ -0,0 +1,14 @@
+package crud
+
+import "github.com/iov-one/cosmos-sdk-crud/internal/util"
+
+// CompositeKey returns the secondary key of the composite index id whose value is made of the given ordered components
+// The components are encoded as a tuple which keeps their order: the values of the index are sorted by their first
+// component, then by their second one, and so on. The objects of a composite index are queried through
+// IndexStatement.Components, which allows to match a leading subset of the components.
+func CompositeKey(id IndexID, components ...[]byte) SecondaryKey {
+	return SecondaryKey{
+		ID:    id,
+		Value: util.EncodeTuple(components...),
+	}
+}
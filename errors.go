@@ -11,6 +11,13 @@ var ErrNotFound = errors.New("crud: not found")
 // ErrAlreadyExists is returned when an index or an object already exist
 var ErrAlreadyExists = errors.New("crud: already exists")
 
+// ErrUniqueViolation is returned when an object has, for an index declared unique,
+// the same value as another object
+var ErrUniqueViolation = fmt.Errorf("%w: unique index violation", ErrAlreadyExists)
+
+// ErrMultipleResults is returned when a query expected to select a single object selects several of them
+var ErrMultipleResults = errors.New("crud: multiple results")
+
 // ErrBadArgument is returned when the provided arguments are invalid
 var ErrBadArgument = errors.New("crud: bad argument")
 
@@ -21,3 +28,38 @@ var ErrInternal = errors.New("crud: internal error")
 // ErrCursorConsumed is returned in case the cursor used for primary key filtering
 // is not valid anymore because it was consumed
 var ErrCursorConsumed = fmt.Errorf("%w: cursor consumed", ErrBadArgument)
+
+// BatchError is returned by the batch operations of the store, it tells which element of the batch failed
+type BatchError struct {
+	// Index is the position of the failing element in the batch
+	Index int
+	// Err is the error of the element, it wraps one of the errors above
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch element %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// UniqueViolationError is returned when an object has, for an index declared unique, the same value as another object
+// it wraps ErrUniqueViolation
+type UniqueViolationError struct {
+	// ID is the unique index
+	ID IndexID
+	// Value is the value of the index both objects have
+	Value []byte
+	// ConflictingKey is the primary key of the object already having the value
+	ConflictingKey []byte
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("%s: value %x of index %d is already used by primary key %x", ErrUniqueViolation, e.Value, e.ID, e.ConflictingKey)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return ErrUniqueViolation
+}
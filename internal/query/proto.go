@@ -0,0 +1,101 @@
+package query
+
+import (
+	"fmt"
+	"math"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
+)
+
+// clauseOperator is the predicate operator of a protobuf clause operator
+// and the number of values the clause takes, -1 meaning at least one
+type clauseOperator struct {
+	operator types.Operator
+	arity    int
+}
+
+var clauseOperators = map[crud.Operator]clauseOperator{
+	crud.Operator_OPERATOR_EQUAL:            {operator: types.Equal, arity: 1},
+	crud.Operator_OPERATOR_GREATER_THAN:     {operator: types.GreaterThan, arity: 1},
+	crud.Operator_OPERATOR_GREATER_OR_EQUAL: {operator: types.GreaterOrEqual, arity: 1},
+	crud.Operator_OPERATOR_LESS_THAN:        {operator: types.LessThan, arity: 1},
+	crud.Operator_OPERATOR_LESS_OR_EQUAL:    {operator: types.LessOrEqual, arity: 1},
+	crud.Operator_OPERATOR_BETWEEN:          {operator: types.Between, arity: 2},
+	crud.Operator_OPERATOR_PREFIX:           {operator: types.Prefix, arity: 1},
+	crud.Operator_OPERATOR_IN:               {operator: types.In, arity: -1},
+	crud.Operator_OPERATOR_EXISTS:           {operator: types.Exists, arity: 0},
+}
+
+// NewQueryFrom returns the query described by the given protobuf query
+// the errors found in the description are returned when the query is run, as for the queries built by the methods
+func NewQueryFrom(s StoreWithDirectQuery, pq *crud.Query) crud.ValidQuery {
+	q := NewQuery(s)
+	if pq == nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, nil query", crud.ErrBadArgument))
+		return q
+	}
+	for i, conjunction := range pq.Conjunctions {
+		if len(conjunction.GetClauses()) == 0 {
+			q.errs = append(q.errs, fmt.Errorf("%w: bad query, conjunction %d has no clause", crud.ErrBadArgument, i))
+			continue
+		}
+		if i > 0 {
+			q.Or()
+		}
+		for _, c := range conjunction.Clauses {
+			q.addClause(c)
+		}
+	}
+	if pq.End != 0 && pq.Start >= pq.End {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, empty range [%d, %d[", crud.ErrBadArgument, pq.Start, pq.End))
+	}
+	q.start, q.end, q.descending = pq.Start, pq.End, pq.Descending
+	if pq.OrderBy != nil {
+		q.OrderBy(q.indexID(pq.OrderBy.IndexId))
+	}
+	if len(pq.ResumeFrom) != 0 {
+		q.ResumeFrom(pq.ResumeFrom)
+	}
+	return q
+}
+
+// addClause adds the condition of a protobuf clause to the current conjunction
+func (q *query) addClause(c *crud.Clause) {
+	if c == nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, nil clause", crud.ErrBadArgument))
+		return
+	}
+	op, ok := clauseOperators[c.Operator]
+	if !ok {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, unknown operator %s", crud.ErrBadArgument, c.Operator))
+		return
+	}
+	if (op.arity >= 0 && len(c.Values) != op.arity) || (op.arity < 0 && len(c.Values) == 0) {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, %s on %d values", crud.ErrBadArgument, op.operator, len(c.Values)))
+		return
+	}
+	if !c.Composite && len(c.Components) != 0 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, components on a clause which is not composite", crud.ErrBadArgument))
+		return
+	}
+	q.Index(q.indexID(c.IndexId))
+	if c.Composite {
+		q.Components(c.Components...)
+	}
+	q.negated = c.Negated
+	if op.operator == types.Between {
+		// checks the bounds
+		q.Between(c.Values[0], c.Values[1])
+		return
+	}
+	q.addPredicate(op.operator, c.Values...)
+}
+
+// indexID converts the index id of a protobuf query, which must fit in a byte
+func (q *query) indexID(id uint32) crud.IndexID {
+	if id > math.MaxUint8 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, index id %d is greater than %d", crud.ErrBadArgument, id, math.MaxUint8))
+	}
+	return crud.IndexID(id)
+}
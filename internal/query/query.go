@@ -1,30 +1,41 @@
 package query
 
 import (
+	"bytes"
 	"fmt"
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 )
 
 type StoreWithDirectQuery interface {
 	crud.Store
-	DoDirectQuery(sks []crud.SecondaryKey, start, end uint64) (crud.Cursor, error)
+	DoDirectQuery(q types.Query) (crud.Cursor, error)
+	DoDirectCount(q types.Query) (uint64, error)
+	DoDirectIndexValues(id crud.IndexID, q types.Query) (crud.IndexValueCursor, error)
+	IsUniqueIndex(id crud.IndexID) bool
 }
 
 func NewQuery(s StoreWithDirectQuery) *query {
 	return &query{
-		store:      s,
-		andEqualSk: make(map[byte]struct{}),
+		store: s,
 	}
 }
 
 type query struct {
-	errs       []error              // errors found during queries
-	andEqualSk map[byte]struct{}    // keep track of indexes ID we want to be equal to (or not supported yet)
-	sks        []crud.SecondaryKey  // secondary keys to query for equality
-	currSk     crud.SecondaryKey    // secondaryKey that is currently being processed
-	store      StoreWithDirectQuery // underlying store to use
-	start, end uint64               // start and end of query
+	errs         []error              // errors found during queries
+	conjunctions []types.Conjunction  // groups of conditions the index values must respect, at least one must match
+	current      int                  // index of the first conjunction the conditions being added apply to
+	currID       crud.IndexID         // index ID that is currently being processed
+	negated      bool                 // if the condition that is currently being processed excludes objects
+	composite    bool                 // if the condition that is currently being processed applies to a component
+	components   [][]byte             // leading components of the composite index currently being processed
+	store        StoreWithDirectQuery // underlying store to use
+	start, end   uint64               // start and end of query
+	descending   bool                 // if results are returned in descending order
+	orderBy      *crud.IndexID        // index whose values define the order of results, primary key order if nil
+	from         []byte               // position from which results are returned
+	filters      []types.Filter       // conditions the decoded objects must pass
 
 	consumed bool // used after the query has run Do()
 }
@@ -33,17 +44,75 @@ func (q *query) And() crud.WhereStatement {
 	return q
 }
 
-func (q *query) Do() (crud.Cursor, error) {
-	// check if there are query errors
-	if len(q.errs) != 0 {
-		return nil, q.errs[0]
+func (q *query) AndNot() crud.WhereStatement {
+	q.negated = true
+	return q
+}
+
+func (q *query) Or() crud.WhereStatement {
+	// start a new group of conditions, in which the indexes of the previous groups can be used again
+	q.current = len(q.conjunctions)
+	q.conjunctions = append(q.conjunctions, types.Conjunction{})
+	return q
+}
+
+func (q *query) Group(fn func(where crud.WhereStatement) crud.FinalizedIndexStatement) crud.FinalizedIndexStatement {
+	negated := q.negated
+	q.negated, q.composite, q.components = false, false, nil
+	if fn == nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, nil group", crud.ErrBadArgument))
+		return q
 	}
-	// check if query was already run
-	if q.consumed {
-		return nil, fmt.Errorf("%w: query already consumed", crud.ErrBadArgument)
+	group := &query{store: q.store}
+	fn(group.Where())
+	q.errs = append(q.errs, group.errs...)
+	switch {
+	case len(group.conjunctions) == 0:
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, empty group", crud.ErrBadArgument))
+		return q
+	case group.start != 0 || group.end != 0 || group.descending || group.orderBy != nil || group.from != nil || len(group.filters) != 0:
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, modifier in group", crud.ErrBadArgument))
+		return q
+	}
+	if len(q.conjunctions) == 0 {
+		q.conjunctions = append(q.conjunctions, types.Conjunction{})
+	}
+	if negated {
+		// not (A or B) is (not A) and (not B), which can be expressed only if A and B are single conditions
+		var exclusions []types.Predicate
+		for _, c := range group.conjunctions {
+			if len(c.Predicates) != 1 || len(c.Exclusions) != 0 {
+				q.errs = append(q.errs, fmt.Errorf("%w: bad query, negated group of several conditions", crud.ErrBadArgument))
+				return q
+			}
+			exclusions = append(exclusions, c.Predicates[0])
+		}
+		for i := q.current; i < len(q.conjunctions); i++ {
+			q.conjunctions[i].Exclusions = append(q.conjunctions[i].Exclusions, exclusions...)
+		}
+		return q
+	}
+	// (A and B) and (C or D) is (A and B and C) or (A and B and D)
+	var distributed []types.Conjunction
+	for _, c := range q.conjunctions[q.current:] {
+		for _, g := range group.conjunctions {
+			distributed = append(distributed, types.Conjunction{
+				Predicates: append(append([]types.Predicate{}, c.Predicates...), g.Predicates...),
+				Exclusions: append(append([]types.Predicate{}, c.Exclusions...), g.Exclusions...),
+			})
+		}
+	}
+	q.conjunctions = append(q.conjunctions[:q.current], distributed...)
+	return q
+}
+
+func (q *query) Do() (crud.Cursor, error) {
+	directQuery, err := q.build()
+	if err != nil {
+		return nil, err
 	}
 	// do query
-	crs, err := q.store.DoDirectQuery(q.sks, q.start, q.end)
+	crs, err := q.store.DoDirectQuery(directQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -53,23 +122,268 @@ func (q *query) Do() (crud.Cursor, error) {
 	return crs, nil
 }
 
+func (q *query) Count() (uint64, error) {
+	directQuery, err := q.build()
+	if err != nil {
+		return 0, err
+	}
+	count, err := q.store.DoDirectCount(directQuery)
+	if err != nil {
+		return 0, err
+	}
+	q.consumed = true
+	return count, nil
+}
+
+func (q *query) IndexValues(id crud.IndexID) (crud.IndexValueCursor, error) {
+	directQuery, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+	if len(directQuery.Conjunctions) != 0 || directQuery.OrderBy != nil || len(directQuery.Filters) != 0 {
+		return nil, fmt.Errorf("%w: bad query, index values are listed without clauses, order or filters", crud.ErrBadArgument)
+	}
+	crs, err := q.store.DoDirectIndexValues(id, directQuery)
+	if err != nil {
+		return nil, err
+	}
+	q.consumed = true
+	return crs, nil
+}
+
+func (q *query) One(o crud.Object) error {
+	crs, err := q.Do()
+	if err != nil {
+		return err
+	}
+	if !crs.Valid() {
+		return notFound(crs)
+	}
+	if err := crs.Read(o); err != nil {
+		return err
+	}
+	crs.Next()
+	if crs.Valid() {
+		return fmt.Errorf("%w: several objects match the query", crud.ErrMultipleResults)
+	}
+	return crs.Error()
+}
+
+func (q *query) MustOne(o crud.Object) {
+	if err := q.One(o); err != nil {
+		panic(err)
+	}
+}
+
+func (q *query) First(o crud.Object) error {
+	crs, err := q.Do()
+	if err != nil {
+		return err
+	}
+	if !crs.Valid() {
+		return notFound(crs)
+	}
+	return crs.Read(o)
+}
+
+// notFound returns the error of a consumed cursor, or ErrNotFound if it did not stop on an error
+func notFound(crs crud.Cursor) error {
+	if err := crs.Error(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: no object matches the query", crud.ErrNotFound)
+}
+
+func (q *query) GetUnique(id crud.IndexID, value []byte, o crud.Object) error {
+	if !q.store.IsUniqueIndex(id) {
+		return fmt.Errorf("%w: index %d is not unique", crud.ErrBadArgument, id)
+	}
+	crs, err := q.Where().Index(id).Equals(value).Do()
+	if err != nil {
+		return err
+	}
+	if !crs.Valid() {
+		if err := crs.Error(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: no object with value %x for unique index %d", crud.ErrNotFound, value, id)
+	}
+	return crs.Read(o)
+}
+
+// build checks the query can be run and returns the query to give to the store
+func (q *query) build() (types.Query, error) {
+	// check if there are query errors
+	if len(q.errs) != 0 {
+		return types.Query{}, q.errs[0]
+	}
+	// check if query was already run
+	if q.consumed {
+		return types.Query{}, fmt.Errorf("%w: query already consumed", crud.ErrBadArgument)
+	}
+	return types.Query{
+		Conjunctions: q.conjunctions,
+		Start:        q.start,
+		End:          q.end,
+		Descending:   q.descending,
+		OrderBy:      q.orderBy,
+		From:         q.from,
+		Filters:      q.filters,
+	}, nil
+}
+
 func (q *query) Index(id crud.IndexID) crud.IndexStatement {
-	bID := (byte)(id)
-	_, ok := q.andEqualSk[bID]
-	if ok {
-		q.errs = append(q.errs, fmt.Errorf("%w: bad query, equality on index with same id %d", crud.ErrBadArgument, bID))
+	q.currID = id
+	return q
+}
+
+func (q *query) Components(leading ...[]byte) crud.IndexStatement {
+	for _, c := range leading {
+		if c == nil {
+			q.errs = append(q.errs, fmt.Errorf("%w: bad query, nil component", crud.ErrBadArgument))
+		}
 	}
-	q.currSk.ID = crud.IndexID(bID)
-	q.andEqualSk[bID] = struct{}{}
+	q.composite = true
+	q.components = leading
 	return q
 }
 
 func (q *query) Equals(v []byte) crud.FinalizedIndexStatement {
-	if v == nil {
-		q.errs = append(q.errs, fmt.Errorf("%w: bad query, equality on nil value", crud.ErrBadArgument))
+	return q.addPredicate(types.Equal, v)
+}
+
+func (q *query) NotEquals(v []byte) crud.FinalizedIndexStatement {
+	q.negated = !q.negated
+	return q.addPredicate(types.Equal, v)
+}
+
+func (q *query) GreaterThan(v []byte) crud.FinalizedIndexStatement {
+	return q.addPredicate(types.GreaterThan, v)
+}
+
+func (q *query) GreaterOrEqual(v []byte) crud.FinalizedIndexStatement {
+	return q.addPredicate(types.GreaterOrEqual, v)
+}
+
+func (q *query) LessThan(v []byte) crud.FinalizedIndexStatement {
+	return q.addPredicate(types.LessThan, v)
+}
+
+func (q *query) LessOrEqual(v []byte) crud.FinalizedIndexStatement {
+	return q.addPredicate(types.LessOrEqual, v)
+}
+
+func (q *query) Between(lower, upper []byte) crud.FinalizedIndexStatement {
+	if lower != nil && upper != nil && bytes.Compare(lower, upper) > 0 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, lower bound %x is greater than upper bound %x", crud.ErrBadArgument, lower, upper))
+	}
+	return q.addPredicate(types.Between, lower, upper)
+}
+
+func (q *query) HasPrefix(p []byte) crud.FinalizedIndexStatement {
+	return q.addPredicate(types.Prefix, p)
+}
+
+func (q *query) In(values ...[]byte) crud.FinalizedIndexStatement {
+	if len(values) == 0 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, in on empty set", crud.ErrBadArgument))
+	}
+	return q.addPredicate(types.In, values...)
+}
+
+func (q *query) Exists() crud.FinalizedIndexStatement {
+	return q.addPredicate(types.Exists)
+}
+
+func (q *query) Missing() crud.FinalizedIndexStatement {
+	q.negated = !q.negated
+	return q.addPredicate(types.Exists)
+}
+
+func (q *query) ContainsAll(values ...[]byte) crud.FinalizedIndexStatement {
+	if len(values) == 0 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, contains all on empty set", crud.ErrBadArgument))
+		return q.addPredicate(types.In, values...)
+	}
+	if q.negated && len(values) > 1 {
+		// excluding the objects having all the values is not a conjunction of exclusions
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, negated contains all on several values", crud.ErrBadArgument))
+	}
+	// the object must have each value, every equality applies to the same composite components
+	composite, components := q.composite, q.components
+	for _, v := range values {
+		q.composite, q.components = composite, components
+		q.addPredicate(types.Equal, v)
+	}
+	return q
+}
+
+func (q *query) ContainsAny(values ...[]byte) crud.FinalizedIndexStatement {
+	if len(values) == 0 {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, contains any on empty set", crud.ErrBadArgument))
+	}
+	return q.addPredicate(types.In, values...)
+}
+
+// addPredicate adds a predicate on the index currently being processed
+// the predicate is added to the exclusions if the condition is negated
+func (q *query) addPredicate(op types.Operator, values ...[]byte) *query {
+	for _, v := range values {
+		if v == nil {
+			q.errs = append(q.errs, fmt.Errorf("%w: bad query, %s on nil value", crud.ErrBadArgument, op))
+		}
+	}
+	if len(q.conjunctions) == 0 {
+		q.conjunctions = append(q.conjunctions, types.Conjunction{})
+	}
+	p := types.Predicate{
+		ID:         q.currID,
+		Operator:   op,
+		Values:     values,
+		Composite:  q.composite,
+		Components: q.components,
+	}
+	q.composite, q.components = false, nil
+	// the predicate applies to every conjunction a group distributed the previous conditions over
+	for i := q.current; i < len(q.conjunctions); i++ {
+		c := &q.conjunctions[i]
+		if q.negated {
+			// excluding several sets of values of the same index is fine
+			c.Exclusions = append(c.Exclusions, p)
+		} else {
+			c.Predicates = append(c.Predicates, p)
+		}
+	}
+	q.negated = false
+	return q
+}
+
+func (q *query) Filter(newObj func() crud.Object, pred func(crud.Object) bool) crud.ValidQuery {
+	if newObj == nil || pred == nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, nil filter", crud.ErrBadArgument))
+	}
+	q.filters = append(q.filters, types.Filter{NewObject: newObj, Predicate: pred})
+	return q
+}
+
+func (q *query) Descending() crud.ValidQuery {
+	q.descending = true
+	return q
+}
+
+func (q *query) OrderBy(id crud.IndexID) crud.ValidQuery {
+	if q.orderBy != nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, already ordered by index %d", crud.ErrBadArgument, *q.orderBy))
+	}
+	q.orderBy = &id
+	return q
+}
+
+func (q *query) ResumeFrom(nextKey []byte) crud.ValidQuery {
+	if nextKey == nil {
+		q.errs = append(q.errs, fmt.Errorf("%w: bad query, resume from nil key", crud.ErrBadArgument))
 	}
-	q.currSk.Value = v
-	q.sks = append(q.sks, q.currSk)
+	q.from = nextKey
 	return q
 }
 
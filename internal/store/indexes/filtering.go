@@ -1,76 +1,433 @@
 package indexes
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
 	sdk "github.com/cosmos/cosmos-sdk/types"
+
 	crud "github.com/iov-one/cosmos-sdk-crud"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/iterator"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
+// Filter returns the primary keys of the objects having all the given secondary keys
+// in the interval [start, end[
 func (s Store) Filter(secondaryKeys []crud.SecondaryKey, start, end uint64) ([][]byte, error) {
 
 	if len(secondaryKeys) == 0 {
 		return nil, crud.ErrBadArgument
 	}
 
-	iterator, err := s.FilterWithIterator(secondaryKeys, start, end)
+	predicates := make([]types.Predicate, len(secondaryKeys))
+	for i, sk := range secondaryKeys {
+		predicates[i] = types.NewEqualityPredicate(sk)
+	}
+	q := types.Query{
+		Conjunctions: []types.Conjunction{{Predicates: predicates}},
+		Start:        start,
+		End:          end,
+	}
+	iterator, err := s.FilterWithIterator(q, nil)
 	if err != nil {
 		return nil, err
 	}
-	return iterator.Collect(), err
+	keys := iterator.Collect()
+	return keys, iterator.Error()
 }
 
-func (s Store) FilterWithIterator(sks []crud.SecondaryKey, start, end uint64) (types.Iterator, error) {
-	rng, err := util.NewRange(start, end)
+// AllKeysFunc returns an iterator over the primary keys of all the objects coming from the primary key from included,
+// in the interval [start, end[ relative to it and in descending order if descending is true, in ascending order otherwise
+// objects.Store.GetKeysFrom is one.
+type AllKeysFunc func(from []byte, start, end uint64, descending bool) (types.Iterator, error)
+
+// FilterWithIterator returns an iterator over the primary keys of the objects matching all the predicates
+// of at least one of the query conjunctions, in the interval [q.Start, q.End[ and in the query order.
+// allKeys is used to get the primary keys of all the objects, when a conjunction only has exclusions.
+// If q.OrderBy is set, the objects are returned in the order of their values for that index,
+// the objects without any value for it are not returned.
+// The iteration starts from q.From, if set, which is a position returned by the iterator of the same query.
+func (s Store) FilterWithIterator(q types.Query, allKeys AllKeysFunc) (types.Iterator, error) {
+	rng, err := util.NewRange(q.Start, q.End)
 	if err != nil {
 		return iterator.NilIterator{}, crud.ErrBadArgument
 	}
-
-	indexStores := make([]sdk.Iterator, len(sks))
-	var kv sdk.KVStore
-	for i, sk := range sks {
-		kv, _, err = s.kvStore(sk)
-		if err != nil {
-			return iterator.NilIterator{}, err
+	// when the ranks are maintained, the iteration starts at the first object of the range
+	if from, ranked, err := s.rankedStart(q); err != nil {
+		return iterator.NilIterator{}, err
+	} else if ranked {
+		if from == nil {
+			return iterator.NilIterator{}, nil
 		}
-		iter := kv.Iterator(nil, nil)
-		indexStores[i] = iter
+		q.From = from
+		rng.Skip(q.Start)
 	}
 
-	it := iterator.NewKeyIterator(func() ([]byte, bool) {
+	var pks pkIterator
+	if q.OrderBy != nil {
+		pks, err = s.orderedIterator(*q.OrderBy, q.Conjunctions, q.From, q.Descending)
+	} else {
+		pks, err = s.conjunctionsIterator(q.Conjunctions, allKeys, q.From, q.Descending)
+	}
+	if err != nil {
+		return iterator.NilIterator{}, err
+	}
+
+	it := iterator.NewPositionedKeyIterator(func() ([]byte, []byte, bool, error) {
 		for {
-			pk, noMoreValues := moveForward(indexStores)
+			noMoreValues := !pks.Valid()
 			inRange, stopIter := rng.CheckAndMoveForward()
 			// if filtering over
 			if noMoreValues || stopIter {
-				return nil, false
+				err := pks.Error()
+				_ = pks.Close()
+				return nil, nil, false, err
 			}
+			pk, position := pks.Key(), iteratorPosition(pks)
+			pks.Next()
 			// if we are in the range [start, end[
 			if inRange {
-				return pk, true
+				return pk, position, true, nil
 			}
 		}
 	})
 	return it, nil
 }
 
-// moveForward takes the next key that is present in all the iterators result sets
-// It assumes keys are ordered (byte-wise, as per bytes.Compare computes) in ascending order
+// Count returns the number of primary keys FilterWithIterator returns for the query
+// a query on a single value of an index is counted in constant time using the index counters,
+// other queries are counted by iterating over their primary keys.
+func (s Store) Count(q types.Query, allKeys AllKeysFunc) (uint64, error) {
+	rng, err := util.NewRange(q.Start, q.End)
+	if err != nil {
+		return 0, crud.ErrBadArgument
+	}
+	if total, ok, err := s.countFromCounters(q); err != nil || ok {
+		return rng.Length(total), err
+	}
+	it, err := s.FilterWithIterator(q, allKeys)
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for ; it.Valid(); it.Next() {
+		count++
+	}
+	return count, it.Error()
+}
+
+// countFromCounters counts the primary keys matching the query using the index counters
+// ok is false if the query cannot be answered by the counters
+func (s Store) countFromCounters(q types.Query) (count uint64, ok bool, err error) {
+	if q.From != nil || q.OrderBy != nil || len(q.Conjunctions) != 1 {
+		return 0, false, nil
+	}
+	conjunction := q.Conjunctions[0]
+	if len(conjunction.Predicates) != 1 || len(conjunction.Exclusions) != 0 {
+		return 0, false, nil
+	}
+	p := conjunction.Predicates[0]
+	if !matchesValues(p) {
+		return 0, false, nil
+	}
+	if p.Operator == types.Equal && len(p.Values) != 1 {
+		return 0, false, fmt.Errorf("%w: equality requires exactly one value, got %d", crud.ErrBadArgument, len(p.Values))
+	}
+	if len(p.Values) == 0 {
+		return 0, false, nil
+	}
+	encodedKey, err := encodeIndexKey(crud.SecondaryKey{ID: p.ID, Value: p.Values[0]})
+	if err != nil {
+		return 0, false, err
+	}
+	for _, v := range p.Values[1:] {
+		// an object can have several of the values of a multi-valued index, the counters of distinct values
+		// cannot be added without counting it several times
+		if !bytes.Equal(v, p.Values[0]) {
+			return 0, false, nil
+		}
+	}
+	return s.metadata.IndexCount(encodedKey), true, nil
+}
+
+// rankedStart returns the primary key of the first object of the query range, found from the ranks of the primary keys
+// ranked is false if the ranks cannot be used for the query, which must be on a single index value without position,
+// primaryKey is nil if the range starts after the last object of the query
+func (s Store) rankedStart(q types.Query) (primaryKey []byte, ranked bool, err error) {
+	if s.ranks == nil || q.Start == 0 || q.From != nil || q.OrderBy != nil || len(q.Conjunctions) != 1 {
+		return nil, false, nil
+	}
+	conjunction := q.Conjunctions[0]
+	if len(conjunction.Predicates) != 1 || len(conjunction.Exclusions) != 0 {
+		return nil, false, nil
+	}
+	p := conjunction.Predicates[0]
+	if !matchesValues(p) || p.Operator != types.Equal || len(p.Values) != 1 {
+		return nil, false, nil
+	}
+	encodedKey, err := encodeIndexKey(crud.SecondaryKey{ID: p.ID, Value: p.Values[0]})
+	if err != nil {
+		return nil, false, err
+	}
+	primaryKey, _, err = s.ranks.Set(encodedKey).Select(q.Start, q.Descending)
+	if err != nil {
+		return nil, false, err
+	}
+	return primaryKey, true, nil
+}
+
+// conjunctionsIterator returns an iterator over the primary keys matching at least one of the conjunctions
+// from the primary key from included
+func (s Store) conjunctionsIterator(conjunctions []types.Conjunction, allKeys AllKeysFunc, from []byte, descending bool) (pkIterator, error) {
+	conjunctionIters := make([]pkIterator, 0, len(conjunctions))
+	for _, conjunction := range conjunctions {
+		iter, err := s.conjunctionIterator(conjunction, allKeys, from, descending)
+		if err != nil {
+			closeAll(conjunctionIters)
+			return nil, err
+		}
+		conjunctionIters = append(conjunctionIters, iter)
+	}
+	if len(conjunctionIters) == 1 {
+		return conjunctionIters[0], nil
+	}
+	return newUnionIterator(conjunctionIters, descending), nil
+}
+
+// conjunctionIterator returns an iterator over the primary keys matching all the predicates of the conjunction
+// and none of its exclusions, from the primary key from included
+func (s Store) conjunctionIterator(conjunction types.Conjunction, allKeys AllKeysFunc, from []byte, descending bool) (pkIterator, error) {
+	if len(conjunction.Predicates) == 0 && len(conjunction.Exclusions) == 0 {
+		return nil, fmt.Errorf("%w: empty conjunction", crud.ErrBadArgument)
+	}
+	included, err := s.intersectPredicates(conjunction.Predicates, allKeys, from, descending)
+	if err != nil {
+		return nil, err
+	}
+	if len(conjunction.Exclusions) == 0 {
+		return included, nil
+	}
+	excluded := make([]pkIterator, 0, len(conjunction.Exclusions))
+	for _, p := range conjunction.Exclusions {
+		iter, err := s.predicateIterator(p, from, descending)
+		if err != nil {
+			closeAll(excluded)
+			_ = included.Close()
+			return nil, err
+		}
+		excluded = append(excluded, iter)
+	}
+	return newDifferenceIterator(included, newUnionIterator(excluded, descending), descending), nil
+}
+
+// intersectPredicates returns an iterator over the primary keys matching all the given predicates
+// from the primary key from included, if no predicate is given, the primary keys of all the objects are returned.
+// The predicates are intersected from the one matching the fewest objects, whatever the order they were given in:
+// the predicates whose cost is known from the index counters and is much bigger than the one of the cheapest predicate
+// are checked by looking the primary keys up instead of being iterated over.
+func (s Store) intersectPredicates(predicates []types.Predicate, allKeys AllKeysFunc, from []byte, descending bool) (pkIterator, error) {
+	if len(predicates) == 0 {
+		if allKeys == nil {
+			return nil, fmt.Errorf("%w: no way to get all the objects", crud.ErrBadArgument)
+		}
+		all, err := allKeys(from, 0, 0, descending)
+		if err != nil {
+			return nil, err
+		}
+		return iteratorAdapter{all}, nil
+	}
+	// sort the predicates by cost, the ones whose cost is unknown are the most expensive
+	costs := make([]uint64, len(predicates))
+	for i, p := range predicates {
+		cost, err := s.predicateCost(p)
+		if err != nil {
+			return nil, err
+		}
+		costs[i] = cost
+	}
+	order := make([]int, len(predicates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return costs[order[i]] < costs[order[j]]
+	})
+
+	indexStores := make([]pkIterator, 0, len(predicates))
+	var lookups []types.Predicate
+	for i, j := range order {
+		p := predicates[j]
+		if i != 0 && costs[j] != unknownCost && costs[j]/probeCostRatio >= costs[order[0]] {
+			lookups = append(lookups, p)
+			continue
+		}
+		iter, err := s.predicateIterator(p, from, descending)
+		if err != nil {
+			closeAll(indexStores)
+			return nil, err
+		}
+		indexStores = append(indexStores, iter)
+	}
+	iter := indexStores[0]
+	if len(indexStores) > 1 {
+		iter = newIntersectionIterator(indexStores, descending)
+	}
+	if len(lookups) == 0 {
+		return iter, nil
+	}
+	return newLookupIterator(iter, func(primaryKey []byte) (bool, error) {
+		for _, p := range lookups {
+			if ok, err := s.hasPrimaryKey(p, primaryKey); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}), nil
+}
+
+// unknownCost is the cost of the predicates whose number of matching objects is not known without iterating over them
+const unknownCost = math.MaxUint64
+
+// probeCostRatio is the minimum ratio between the cost of a predicate and the cost of the cheapest predicate of an
+// intersection for the predicate to be checked by looking primary keys up, as a lookup costs several iteration steps.
+const probeCostRatio = 4
+
+// predicateCost returns the number of objects matching the predicate, as given by the index counters
+// or unknownCost if the predicate is not on a single value or set of values
+func (s Store) predicateCost(p types.Predicate) (uint64, error) {
+	if !matchesValues(p) {
+		return unknownCost, nil
+	}
+	var cost uint64
+	for _, v := range p.Values {
+		encodedKey, err := encodeIndexKey(crud.SecondaryKey{ID: p.ID, Value: v})
+		if err != nil {
+			return 0, err
+		}
+		cost += s.metadata.IndexCount(encodedKey)
+	}
+	return cost, nil
+}
+
+// matchesValues checks if the predicate is on a single value or set of values, whose objects
+// are the ones pointed by the index keys of the values, the predicates on the components of a composite index are not
+func matchesValues(p types.Predicate) bool {
+	return !p.Composite && (p.Operator == types.Equal || p.Operator == types.In)
+}
+
+// hasPrimaryKey checks if the given primary key is pointed by the index keys of the values of the predicate
+// only the predicates on a single value or set of values can be checked this way
+func (s Store) hasPrimaryKey(p types.Predicate, primaryKey []byte) (bool, error) {
+	for _, v := range p.Values {
+		kv, _, err := s.kvStore(crud.SecondaryKey{ID: p.ID, Value: v})
+		if err != nil {
+			return false, err
+		}
+		if kv.Has(primaryKey) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// predicateIterator returns an iterator over the primary keys matching the given predicate from the primary key from included
+// equality is answered by iterating over the store prefixed by the value, a set of values by merging
+// the iterators of the equalities on its values, other operators, as well as the conditions on the components
+// of a composite index, require a bounded scan of the index, whose index keys are merged.
+func (s Store) predicateIterator(p types.Predicate, from []byte, descending bool) (pkIterator, error) {
+	switch {
+	case p.Operator == types.In:
+		iters := make([]pkIterator, 0, len(p.Values))
+		for _, v := range p.Values {
+			equality := p
+			equality.Operator, equality.Values = types.Equal, [][]byte{v}
+			iter, err := s.predicateIterator(equality, from, descending)
+			if err != nil {
+				closeAll(iters)
+				return nil, err
+			}
+			iters = append(iters, iter)
+		}
+		return newUnionIterator(iters, descending), nil
+	case p.Operator == types.Equal && !p.Composite:
+		if len(p.Values) != 1 {
+			return nil, fmt.Errorf("%w: equality requires exactly one value, got %d", crud.ErrBadArgument, len(p.Values))
+		}
+		return s.valueIterator(crud.SecondaryKey{ID: p.ID, Value: p.Values[0]}, from, descending)
+	}
+	start, end, err := encodePredicateRange(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanRange(start, end, from, descending)
+}
+
+// valueIterator returns an iterator over the primary keys indexed by the given secondary key
+// from the primary key from included
+func (s Store) valueIterator(sk crud.SecondaryKey, from []byte, descending bool) (pkIterator, error) {
+	kv, _, err := s.kvStore(sk)
+	if err != nil {
+		return nil, err
+	}
+	return newStoreIterator(kv, from, descending), nil
+}
+
+// scanRange returns an iterator over the primary keys pointed by the index keys in the interval [start, end[
+// which come from the primary key from included. The primary keys of each index key are sorted and merged,
+// which requires the first primary key of every index key of the interval before yielding the first one:
+// the cost of the iterator grows with the number of distinct index keys of the interval, whatever the range of the query.
+// The interval is walked by a single iterator which reads the primary keys of the index keys having few of them,
+// the index keys having more primary keys are iterated over separately and skipped by reopening the walking iterator.
+func (s Store) scanRange(start, end []byte, from []byte, descending bool) (pkIterator, error) {
+	var iters []pkIterator
+	walk := s.indexes.Iterator(start, end)
+	defer func() { _ = walk.Close() }()
+	for walk.Valid() {
+		encodedKey, _, err := splitIndexKey(walk.Key())
+		if err != nil {
+			closeAll(iters)
+			return nil, err
+		}
+		encodedKey = append([]byte{}, encodedKey...)
+		// read the primary keys of the index key, up to gallopSteps of them
+		var primaryKeys [][]byte
+		for ; walk.Valid() && bytes.HasPrefix(walk.Key(), encodedKey) && len(primaryKeys) < gallopSteps; walk.Next() {
+			primaryKeys = append(primaryKeys, append([]byte{}, walk.Key()[len(encodedKey):]...))
+		}
+		if !walk.Valid() || !bytes.HasPrefix(walk.Key(), encodedKey) {
+			iter := newSliceIterator(primaryKeys, descending)
+			if from != nil {
+				iter.Seek(from)
+			}
+			iters = append(iters, iter)
+			continue
+		}
+		iters = append(iters, newStoreIterator(s.kvStoreRaw(encodedKey), from, descending))
+		_ = walk.Close()
+		walk = s.indexes.Iterator(sdk.PrefixEndBytes(encodedKey), end)
+	}
+	return newMergeIterator(iters, descending), nil
+}
+
+// moveForward finds the next key that is present in all the iterators result sets, starting from their current keys
+// It assumes keys are ordered (byte-wise, as per bytes.Compare computes) in ascending order,
+// or in descending order if descending is true
+// The iterators leapfrog each other: each iterator seeks the candidate key found so far, so the iterators
+// which can seek skip the keys before it instead of going through them one by one.
+// When a key is found all the iterators are positioned on it.
 // If the stop return value is false, then primaryKey is meaningless and there are no more results
-func moveForward(iters []sdk.Iterator) (primaryKey []byte, stop bool) {
+func moveForward(iters []pkIterator, descending bool) (primaryKey []byte, stop bool) {
 	// If no iterator is given, then there is no matching key
 	n := len(iters)
-	if n == 0 {
+	if n == 0 || !iters[0].Valid() {
 		return nil, true
 	}
 
-	// Initialisation: retrieve the first value of the first iterator
-	if !iters[0].Valid() {
-		return nil, true
-	}
-	// The current candidate key
-	candidateKey := nextKey(iters[0])
+	// The current candidate key is the key of the first iterator, which should be the one with the fewest keys
+	candidateKey := iters[0].Key()
 	// The index of the tested iterator in the iterator array
 	i := 1
 	// The number of remaining iterators to check in order to validate the candidate key
@@ -78,37 +435,22 @@ func moveForward(iters []sdk.Iterator) (primaryKey []byte, stop bool) {
 
 	// While we have not validated the key against all the iterators, continue
 	for remainingIterators > 0 {
+		seek(iters[i], candidateKey, descending)
 		// If any of the iterator is fully consumed then no more results can be found
 		if !iters[i].Valid() {
 			return nil, true
 		}
-
-		// We retrieve the next key from this iterator to test it against the candidate key
-		currentKey := nextKey(iters[i])
-		bigger, equal := util.BytesBiggerEqual(currentKey, candidateKey)
-		// If the current key is greater than the candidate key, then there is no chance of validating the candidate key.
-		// That is because, as this iterator is ordered in ascending order, we now can guarantee that the candidate key
-		// is not present in this iterator's result set
-		if bigger {
-			// The current key is our new candidate key
-			// We reset the remainingIterators counter and skip to the next iterator
+		// The iterator is now on the first key which does not come before the candidate key
+		if currentKey := iters[i].Key(); !bytes.Equal(currentKey, candidateKey) {
+			// The candidate key is not in this iterator's result set, its key is our new candidate key
+			// We reset the remainingIterators counter
 			remainingIterators = n - 1
 			candidateKey = currentKey
-			i = (i + 1) % n
-		} else if equal {
-			// If the candidate key and the current key match, we decrement the remainingIterators counter
-			// and skip to the next iterator
+		} else {
 			remainingIterators--
-			i = (i + 1) % n
 		}
+		i = (i + 1) % n
 	}
 	// If we reach the end of the function, the candidate key has been validated for all the iterators so is a valid key
 	return candidateKey, false
 }
-
-// nextKey fetches a key from the iterator and then moves it forward
-func nextKey(it sdk.Iterator) []byte {
-	key := it.Key()
-	it.Next()
-	return key
-}
@@ -2,11 +2,16 @@ package indexes
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/iterator"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 	"github.com/iov-one/cosmos-sdk-crud/internal/test"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
 func Test_filtering(t *testing.T) {
@@ -15,7 +20,7 @@ func Test_filtering(t *testing.T) {
 		t.Fatalf("failed to create tests: %s", err)
 	}
 	testKVStore := ctx.KVStore(key)
-	store := NewStore(cdc, testKVStore)
+	store := newTestStore(cdc, testKVStore)
 
 	// Add some test objects to the index in order to test filtering
 	err = store.Index(test.NewCustomObject("pk4", "a2", "b3"))
@@ -221,6 +226,1073 @@ func Test_filtering(t *testing.T) {
 	})
 }
 
+func Test_filteringRanges(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+
+	cases := []struct {
+		name       string
+		predicates []types.Predicate
+		start, end uint64
+		descending bool
+		expected   []string
+	}{
+		{
+			name:       "greater than",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.GreaterThan, Values: [][]byte{[]byte("a2")}}},
+			expected:   []string{"pk5", "pk6", "pk7", "pk8", "pk9"},
+		},
+		{
+			name:       "greater or equal",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.GreaterOrEqual, Values: [][]byte{[]byte("a2")}}},
+			expected:   []string{"pk2", "pk4", "pk5", "pk6", "pk7", "pk8", "pk9", "pk90"},
+		},
+		{
+			name:       "less than",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.LessThan, Values: [][]byte{[]byte("a2")}}},
+			expected:   []string{"pk1", "pk3"},
+		},
+		{
+			name:       "less or equal",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.LessOrEqual, Values: [][]byte{[]byte("a2")}}},
+			expected:   []string{"pk1", "pk2", "pk3", "pk4", "pk90"},
+		},
+		{
+			name:       "between",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.Between, Values: [][]byte{[]byte("a2"), []byte("a3")}}},
+			expected:   []string{"pk2", "pk4", "pk5", "pk9", "pk90"},
+		},
+		{
+			name:       "between same value",
+			predicates: []types.Predicate{{ID: 0x1, Operator: types.Between, Values: [][]byte{[]byte("b2"), []byte("b2")}}},
+			expected:   []string{"pk2", "pk3"},
+		},
+		{
+			name: "and with equality",
+			predicates: []types.Predicate{
+				{ID: 0x0, Operator: types.Between, Values: [][]byte{[]byte("a2"), []byte("a4")}},
+				{ID: 0x1, Operator: types.Equal, Values: [][]byte{[]byte("b3")}},
+			},
+			expected: []string{"pk4", "pk5", "pk6", "pk90"},
+		},
+		{
+			name: "and with range",
+			predicates: []types.Predicate{
+				{ID: 0x1, Operator: types.LessThan, Values: [][]byte{[]byte("b3")}},
+				{ID: 0x0, Operator: types.GreaterOrEqual, Values: [][]byte{[]byte("a2")}},
+			},
+			expected: []string{"pk2", "pk7", "pk8", "pk9"},
+		},
+		{
+			name: "and with range/descending",
+			predicates: []types.Predicate{
+				{ID: 0x1, Operator: types.LessThan, Values: [][]byte{[]byte("b3")}},
+				{ID: 0x0, Operator: types.GreaterOrEqual, Values: [][]byte{[]byte("a2")}},
+			},
+			descending: true,
+			expected:   []string{"pk9", "pk8", "pk7", "pk2"},
+		},
+		{
+			name: "and with range/range limit and offset",
+			predicates: []types.Predicate{
+				{ID: 0x0, Operator: types.Between, Values: [][]byte{[]byte("a2"), []byte("a4")}},
+				{ID: 0x1, Operator: types.Equal, Values: [][]byte{[]byte("b3")}},
+			},
+			start:    1,
+			end:      3,
+			expected: []string{"pk5", "pk6"},
+		},
+		{
+			name:       "prefix",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a2")}}},
+			expected:   []string{"pk2", "pk4", "pk9", "pk90"},
+		},
+		{
+			name:       "prefix/empty prefix",
+			predicates: []types.Predicate{{ID: 0x1, Operator: types.Prefix, Values: [][]byte{[]byte("")}}},
+			expected:   []string{"pk1", "pk2", "pk3", "pk4", "pk5", "pk6", "pk7", "pk8", "pk9", "pk90"},
+		},
+		{
+			name: "prefix/and with equality",
+			predicates: []types.Predicate{
+				{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a")}},
+				{ID: 0x1, Operator: types.Prefix, Values: [][]byte{[]byte("b2")}},
+			},
+			expected: []string{"pk2", "pk3", "pk9"},
+		},
+		{
+			name:       "prefix/no match",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a22")}}},
+			expected:   []string{},
+		},
+		{
+			name:       "empty result",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.GreaterThan, Values: [][]byte{[]byte("b1")}}},
+			expected:   []string{},
+		},
+		{
+			name:       "empty interval",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.LessThan, Values: [][]byte{[]byte("")}}},
+			expected:   []string{},
+		},
+		{
+			name:       "nonexistent index",
+			predicates: []types.Predicate{{ID: 0x4, Operator: types.GreaterOrEqual, Values: [][]byte{[]byte("")}}},
+			expected:   []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			it, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{{Predicates: c.predicates}}, Start: c.start, End: c.end, Descending: c.descending}, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+
+	t.Run("prefix/escaped values", func(t *testing.T) {
+		test.CheckNoError(t, store.Index(test.NewCustomObject("pk10", "c\x00", "")))
+		test.CheckNoError(t, store.Index(test.NewCustomObject("pk11", "c\x00\x01", "")))
+		test.CheckNoError(t, store.Index(test.NewCustomObject("pk12", "c\x01", "")))
+		predicates := []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("c\x00")}}}
+		it, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{{Predicates: predicates}}}, nil)
+		test.CheckNoError(t, err)
+		checkExpected(t, it.Collect(), []string{"pk10", "pk11"})
+	})
+
+	t.Run("values with many primary keys", func(t *testing.T) {
+		// the primary keys of the values having more than gallopSteps of them are iterated over separately
+		var expected []string
+		for i := 0; i < 30; i++ {
+			pk := fmt.Sprintf("pk2%02d", i)
+			value := []string{"d1", "d2", "d3"}[i%3]
+			if i%3 == 1 && i > 3 {
+				value = "d4"
+			}
+			test.CheckNoError(t, store.Index(test.NewCustomObject(pk, value, "")))
+			expected = append(expected, pk)
+		}
+		predicates := []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("d")}}}
+		for _, descending := range []bool{false, true} {
+			ordered := append([]string{}, expected...)
+			if descending {
+				sort.Sort(sort.Reverse(sort.StringSlice(ordered)))
+			}
+			q := types.Query{Conjunctions: []types.Conjunction{{Predicates: predicates}}, Descending: descending}
+			it, err := store.FilterWithIterator(q, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), ordered)
+			q.From = []byte(ordered[11])
+			it, err = store.FilterWithIterator(q, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), ordered[11:])
+		}
+	})
+
+	t.Run("missing value", func(t *testing.T) {
+		predicates := []types.Predicate{{ID: 0x0, Operator: types.Between, Values: [][]byte{[]byte("a2")}}}
+		_, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{{Predicates: predicates}}}, nil)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+	})
+}
+
+func Test_filteringUnions(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	cases := []struct {
+		name         string
+		conjunctions []types.Conjunction
+		start, end   uint64
+		descending   bool
+		expected     []string
+	}{
+		{
+			name: "in",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a4"), []byte("a1")}}}},
+			},
+			expected: []string{"pk1", "pk3", "pk6", "pk8"},
+		},
+		{
+			name: "in/nonexistent value",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a1"), []byte("zz")}}}},
+			},
+			expected: []string{"pk1", "pk3"},
+		},
+		{
+			name: "in/duplicated value",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a1"), []byte("a1")}}}},
+			},
+			expected: []string{"pk1", "pk3"},
+		},
+		{
+			name: "in/and with equality",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{
+					{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a2"), []byte("a4")}},
+					equal(0x1, "b3"),
+				}},
+			},
+			expected: []string{"pk4", "pk6", "pk90"},
+		},
+		{
+			name: "or",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a1")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			},
+			expected: []string{"pk1", "pk3", "pk4", "pk5", "pk6", "pk90"},
+		},
+		{
+			name: "or/overlapping",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			},
+			expected: []string{"pk2", "pk4", "pk5", "pk6", "pk90"},
+		},
+		{
+			name: "or/of and",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2"), equal(0x1, "b2")}},
+				{Predicates: []types.Predicate{equal(0x0, "a4"), equal(0x1, "a4")}},
+			},
+			expected: []string{"pk2", "pk8"},
+		},
+		{
+			name: "or/range limit and offset",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			},
+			start:    1,
+			end:      4,
+			expected: []string{"pk4", "pk5", "pk6"},
+		},
+		{
+			name: "or/descending",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			},
+			descending: true,
+			expected:   []string{"pk90", "pk6", "pk5", "pk4", "pk2"},
+		},
+		{
+			name: "or/descending range limit and offset",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			},
+			start:      1,
+			end:        3,
+			descending: true,
+			expected:   []string{"pk6", "pk5"},
+		},
+		{
+			name: "in/descending",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{
+					{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a2"), []byte("a4")}},
+					equal(0x1, "b3"),
+				}},
+			},
+			descending: true,
+			expected:   []string{"pk90", "pk6", "pk4"},
+		},
+		{
+			name: "or/empty results",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "zz")}},
+				{Predicates: []types.Predicate{equal(0x0, "a1"), equal(0x1, "b3")}},
+			},
+			expected: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			it, err := store.FilterWithIterator(types.Query{Conjunctions: c.conjunctions, Start: c.start, End: c.end, Descending: c.descending}, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+
+	t.Run("empty conjunction", func(t *testing.T) {
+		_, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{{}}}, nil)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+	})
+}
+
+func Test_filteringExclusions(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+	allKeys := indexFilteringTestAllKeys
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	cases := []struct {
+		name         string
+		conjunctions []types.Conjunction
+		start, end   uint64
+		descending   bool
+		expected     []string
+	}{
+		{
+			name: "and not",
+			conjunctions: []types.Conjunction{{
+				Predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a")}}},
+				Exclusions: []types.Predicate{equal(0x1, "b3")},
+			}},
+			expected: []string{"pk1", "pk2", "pk3", "pk8", "pk9"},
+		},
+		{
+			name: "and not/range",
+			conjunctions: []types.Conjunction{{
+				Predicates: []types.Predicate{equal(0x1, "b3")},
+				Exclusions: []types.Predicate{{ID: 0x0, Operator: types.LessThan, Values: [][]byte{[]byte("a3")}}},
+			}},
+			expected: []string{"pk5", "pk6"},
+		},
+		{
+			name: "and not/everything excluded",
+			conjunctions: []types.Conjunction{{
+				Predicates: []types.Predicate{equal(0x1, "b3")},
+				Exclusions: []types.Predicate{equal(0x1, "b3")},
+			}},
+			expected: []string{},
+		},
+		{
+			name: "not equals",
+			conjunctions: []types.Conjunction{{
+				Exclusions: []types.Predicate{equal(0x0, "a2")},
+			}},
+			expected: []string{"pk1", "pk3", "pk5", "pk6", "pk7", "pk8", "pk9"},
+		},
+		{
+			name: "not equals/multiple values",
+			conjunctions: []types.Conjunction{{
+				Exclusions: []types.Predicate{equal(0x0, "a2"), equal(0x0, "a1")},
+			}},
+			expected: []string{"pk5", "pk6", "pk7", "pk8", "pk9"},
+		},
+		{
+			name: "not equals/range limit and offset",
+			conjunctions: []types.Conjunction{{
+				Exclusions: []types.Predicate{equal(0x0, "a2")},
+			}},
+			start:    2,
+			end:      4,
+			expected: []string{"pk5", "pk6"},
+		},
+		{
+			name: "or",
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a1")}},
+				{Exclusions: []types.Predicate{{ID: 0x1, Operator: types.Prefix, Values: [][]byte{[]byte("b")}}}},
+			},
+			expected: []string{"pk1", "pk3", "pk7", "pk8"},
+		},
+		{
+			name: "and not/descending",
+			conjunctions: []types.Conjunction{{
+				Predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a")}}},
+				Exclusions: []types.Predicate{equal(0x1, "b3")},
+			}},
+			descending: true,
+			expected:   []string{"pk9", "pk8", "pk3", "pk2", "pk1"},
+		},
+		{
+			name: "not equals/descending range limit and offset",
+			conjunctions: []types.Conjunction{{
+				Exclusions: []types.Predicate{equal(0x0, "a2")},
+			}},
+			start:      1,
+			end:        3,
+			descending: true,
+			expected:   []string{"pk8", "pk7"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			it, err := store.FilterWithIterator(types.Query{Conjunctions: c.conjunctions, Start: c.start, End: c.end, Descending: c.descending}, allKeys)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+
+	t.Run("not equals/no objects", func(t *testing.T) {
+		conjunctions := []types.Conjunction{{Exclusions: []types.Predicate{equal(0x0, "a2")}}}
+		_, err := store.FilterWithIterator(types.Query{Conjunctions: conjunctions}, nil)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+	})
+}
+
+func Test_filteringOrdered(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	prefix := func(id crud.IndexID, v string) types.Predicate {
+		return types.Predicate{ID: id, Operator: types.Prefix, Values: [][]byte{[]byte(v)}}
+	}
+	cases := []struct {
+		name         string
+		orderBy      crud.IndexID
+		conjunctions []types.Conjunction
+		start, end   uint64
+		descending   bool
+		expected     []string
+	}{
+		{
+			name:     "all",
+			orderBy:  0x0,
+			expected: []string{"pk1", "pk3", "pk2", "pk4", "pk90", "pk9", "pk5", "pk6", "pk8", "pk7"},
+		},
+		{
+			name:       "all/descending",
+			orderBy:    0x0,
+			descending: true,
+			expected:   []string{"pk7", "pk8", "pk6", "pk5", "pk9", "pk90", "pk4", "pk2", "pk3", "pk1"},
+		},
+		{
+			name:     "all/range limit and offset",
+			orderBy:  0x0,
+			start:    2,
+			end:      5,
+			expected: []string{"pk2", "pk4", "pk90"},
+		},
+		{
+			name:         "equality on other index",
+			orderBy:      0x0,
+			conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "b3")}}},
+			expected:     []string{"pk4", "pk90", "pk5", "pk6"},
+		},
+		{
+			name:         "prefix on other index",
+			orderBy:      0x1,
+			conjunctions: []types.Conjunction{{Predicates: []types.Predicate{prefix(0x0, "a2")}}},
+			expected:     []string{"pk2", "pk9", "pk4", "pk90"},
+		},
+		{
+			name:         "in on ordering index",
+			orderBy:      0x0,
+			conjunctions: []types.Conjunction{{Predicates: []types.Predicate{{ID: 0x0, Operator: types.In, Values: [][]byte{[]byte("a4"), []byte("a1")}}}}},
+			descending:   true,
+			expected:     []string{"pk8", "pk6", "pk3", "pk1"},
+		},
+		{
+			name:         "exclusion",
+			orderBy:      0x0,
+			conjunctions: []types.Conjunction{{Exclusions: []types.Predicate{prefix(0x1, "b")}}},
+			expected:     []string{"pk8", "pk7"},
+		},
+		{
+			name:    "or",
+			orderBy: 0x1,
+			conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a1")}},
+				{Predicates: []types.Predicate{equal(0x0, "a4")}},
+			},
+			expected: []string{"pk8", "pk1", "pk3", "pk6"},
+		},
+		{
+			name:     "no object indexed",
+			orderBy:  0x2,
+			expected: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orderBy := c.orderBy
+			q := types.Query{Conjunctions: c.conjunctions, Start: c.start, End: c.end, Descending: c.descending, OrderBy: &orderBy}
+			it, err := store.FilterWithIterator(q, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+
+	t.Run("empty conjunction", func(t *testing.T) {
+		orderBy := crud.IndexID(0x0)
+		_, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{{}}, OrderBy: &orderBy}, nil)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+	})
+
+	t.Run("corrupted index list", func(t *testing.T) {
+		ctx, key, cdc, err := test.New()
+		if err != nil {
+			t.Fatalf("failed to create tests: %s", err)
+		}
+		store := newTestStore(cdc, ctx.KVStore(key))
+		indexFilteringTestObjects(t, store)
+		store.primaryKeysIndexes.Set([]byte("pk2"), []byte{0xFF})
+		orderBy := crud.IndexID(0x0)
+		it, err := store.FilterWithIterator(types.Query{OrderBy: &orderBy}, nil)
+		test.CheckNoError(t, err)
+		// the iteration stops at the object whose index list cannot be read
+		checkExpected(t, it.Collect(), []string{"pk1", "pk3"})
+		if err := it.Error(); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+		if _, err := store.Count(types.Query{OrderBy: &orderBy}, nil); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+	})
+}
+
+// Test_orderedPostingLists checks that the objects read from the equalities of a query ordered by an index
+// are yielded as walking the index yields them, for objects having several values for the index too
+func Test_orderedPostingLists(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	for i := 0; i < 40; i++ {
+		keys := []crud.SecondaryKey{
+			{ID: 0x0, Value: []byte(fmt.Sprintf("o%d", i%7))},
+			{ID: 0x1, Value: []byte(fmt.Sprintf("g%d", i%3))},
+			{ID: 0x2, Value: []byte(fmt.Sprintf("h%d", i%5))},
+		}
+		if i%4 == 0 {
+			keys = append(keys, crud.SecondaryKey{ID: 0x0, Value: []byte(fmt.Sprintf("o%d", i%11))})
+		}
+		test.CheckNoError(t, store.Index(keysObject{Object: test.NewCustomObject(fmt.Sprintf("pk%02d", i), "", ""), keys: keys}))
+	}
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	queries := map[string][]types.Conjunction{
+		"equality": {{Predicates: []types.Predicate{equal(0x1, "g0")}}},
+		"set of values": {{Predicates: []types.Predicate{
+			{ID: 0x1, Operator: types.In, Values: [][]byte{[]byte("g0"), []byte("g2")}},
+			equal(0x2, "h1"),
+		}}},
+		"or": {
+			{Predicates: []types.Predicate{equal(0x1, "g1")}},
+			{Predicates: []types.Predicate{equal(0x2, "h0")}, Exclusions: []types.Predicate{equal(0x0, "o3")}},
+		},
+		"ordering index": {{Predicates: []types.Predicate{equal(0x0, "o2")}}},
+	}
+	// collect returns the primary keys and the positions the iterator yields
+	collect := func(t *testing.T, it pkIterator) (keys, positions []string) {
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			keys, positions = append(keys, string(it.Key())), append(positions, string(iteratorPosition(it)))
+		}
+		test.CheckNoError(t, it.Error())
+		return keys, positions
+	}
+	for name, conjunctions := range queries {
+		for _, descending := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/descending=%t", name, descending), func(t *testing.T) {
+				matchers := make([]conjunctionMatcher, len(conjunctions))
+				for i, conjunction := range conjunctions {
+					m, err := newConjunctionMatcher(conjunction)
+					test.CheckNoError(t, err)
+					matchers[i] = m
+				}
+				predicates, ok, err := store.postingLists(conjunctions)
+				test.CheckNoError(t, err)
+				if !ok {
+					t.Fatal("the objects should be read from the equalities")
+				}
+				expectedKeys, expectedPositions := collect(t, store.walkingIterator(0x0, matchers, nil, descending))
+				if len(expectedKeys) == 0 {
+					t.Fatal("the query should select objects")
+				}
+				// resuming from the i-th position yields the keys from the i-th one
+				check := func(from []byte, i int) {
+					it, err := store.postingListIterator(0x0, matchers, predicates, from, descending)
+					test.CheckNoError(t, err)
+					keys, positions := collect(t, it)
+					if !reflect.DeepEqual(keys, expectedKeys[i:]) || !reflect.DeepEqual(positions, expectedPositions[i:]) {
+						t.Fatalf("unexpected keys from %x (expected : %v, actual : %v)", from, expectedKeys[i:], keys)
+					}
+				}
+				check(nil, 0)
+				for i, position := range expectedPositions {
+					check([]byte(position), i)
+				}
+			})
+		}
+	}
+}
+
+func Test_filteringResume(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	rangeQuery := types.Conjunction{Predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("a")}}}}
+	orderBy := crud.IndexID(0x1)
+	cases := []struct {
+		name  string
+		query types.Query
+	}{
+		{
+			name:  "equality",
+			query: types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "b3")}}}},
+		},
+		{
+			name:  "range",
+			query: types.Query{Conjunctions: []types.Conjunction{rangeQuery}},
+		},
+		{
+			name: "or",
+			query: types.Query{Conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{{ID: 0x1, Operator: types.In, Values: [][]byte{[]byte("b1"), []byte("b3")}}}},
+			}},
+		},
+		{
+			name:  "not equals",
+			query: types.Query{Conjunctions: []types.Conjunction{{Exclusions: []types.Predicate{equal(0x0, "a2")}}}},
+		},
+		{
+			name:  "ordered",
+			query: types.Query{Conjunctions: []types.Conjunction{rangeQuery}, OrderBy: &orderBy},
+		},
+	}
+	for _, c := range cases {
+		for _, descending := range []bool{false, true} {
+			q := c.query
+			q.Descending = descending
+			t.Run(fmt.Sprintf("%s/descending=%t", c.name, descending), func(t *testing.T) {
+				it, err := store.FilterWithIterator(q, indexFilteringTestAllKeys)
+				test.CheckNoError(t, err)
+				var keys, positions [][]byte
+				for ; it.Valid(); it.Next() {
+					keys = append(keys, it.Get())
+					positions = append(positions, it.Position())
+				}
+				if len(keys) < 2 {
+					t.Fatal("Not enough results to test resuming:", keys)
+				}
+				// resuming from any position yields the results from it
+				for i, position := range positions {
+					resumed := q
+					resumed.From = position
+					it, err := store.FilterWithIterator(resumed, indexFilteringTestAllKeys)
+					test.CheckNoError(t, err)
+					if actual := it.Collect(); !reflect.DeepEqual(actual, keys[i:]) {
+						t.Fatal("Result set does not match when resuming at", i, "(expected :", keys[i:], ", actual :", actual, ")")
+					}
+				}
+				// the range is relative to the position
+				resumed := q
+				resumed.From, resumed.Start, resumed.End = positions[1], 0, 1
+				it, err = store.FilterWithIterator(resumed, indexFilteringTestAllKeys)
+				test.CheckNoError(t, err)
+				if actual := it.Collect(); !reflect.DeepEqual(actual, keys[1:2]) {
+					t.Fatal("Result set does not match (expected :", keys[1:2], ", actual :", actual, ")")
+				}
+			})
+		}
+	}
+
+	t.Run("ordered/position out of index", func(t *testing.T) {
+		q := types.Query{OrderBy: &orderBy, From: []byte{0x0}}
+		_, err := store.FilterWithIterator(q, nil)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+	})
+}
+
+func Test_count(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	indexFilteringTestObjects(t, store)
+
+	equal := func(id crud.IndexID, v string) types.Predicate {
+		return types.NewEqualityPredicate(crud.SecondaryKey{ID: id, Value: []byte(v)})
+	}
+	in := func(id crud.IndexID, values ...string) types.Predicate {
+		p := types.Predicate{ID: id, Operator: types.In}
+		for _, v := range values {
+			p.Values = append(p.Values, []byte(v))
+		}
+		return p
+	}
+	orderBy := crud.IndexID(0x0)
+	cases := []struct {
+		name     string
+		query    types.Query
+		expected uint64
+	}{
+		{
+			name:     "equality",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "b3")}}}},
+			expected: 4,
+		},
+		{
+			name:     "equality/range limit and offset",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "b3")}}}, Start: 1, End: 3},
+			expected: 2,
+		},
+		{
+			name:     "equality/offset after the end",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "b3")}}}, Start: 5},
+			expected: 0,
+		},
+		{
+			name:     "equality/no object",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x1, "c")}}}},
+			expected: 0,
+		},
+		{
+			name:     "in with duplicate values",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{in(0x0, "a1", "a2", "a1")}}}},
+			expected: 5,
+		},
+		{
+			name:     "and",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x0, "a2"), equal(0x1, "b3")}}}},
+			expected: 2,
+		},
+		{
+			name: "or",
+			query: types.Query{Conjunctions: []types.Conjunction{
+				{Predicates: []types.Predicate{equal(0x0, "a2")}},
+				{Predicates: []types.Predicate{equal(0x1, "b3")}},
+			}},
+			expected: 5,
+		},
+		{
+			name:     "not equals",
+			query:    types.Query{Conjunctions: []types.Conjunction{{Exclusions: []types.Predicate{equal(0x0, "a2")}}}},
+			expected: 7,
+		},
+		{
+			name:     "ordered",
+			query:    types.Query{OrderBy: &orderBy, Start: 2},
+			expected: 8,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			count, err := store.Count(c.query, indexFilteringTestAllKeys)
+			test.CheckNoError(t, err)
+			if count != c.expected {
+				t.Fatal("Unexpected count (expecting", c.expected, ", actual", count, ")")
+			}
+			it, err := store.FilterWithIterator(c.query, indexFilteringTestAllKeys)
+			test.CheckNoError(t, err)
+			if keys := it.Collect(); uint64(len(keys)) != count {
+				t.Fatal("Count does not match the number of filtered keys (count", count, ", keys", keys, ")")
+			}
+		})
+	}
+
+	t.Run("counters follow deletes", func(t *testing.T) {
+		q := types.Query{Conjunctions: []types.Conjunction{{Predicates: []types.Predicate{equal(0x0, "a4")}}}}
+		test.CheckNoError(t, store.Delete([]byte("pk8")))
+		count, err := store.Count(q, nil)
+		test.CheckNoError(t, err)
+		if count != 1 {
+			t.Fatal("Unexpected count (expecting 1, actual", count, ")")
+		}
+	})
+}
+
+func Test_filteringSkewed(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	// every object has the common value, only a few of them have the rare one
+	for i := 0; i < 40; i++ {
+		sk2 := "other"
+		if i%12 == 5 {
+			sk2 = "rare"
+		}
+		test.CheckNoError(t, store.Index(test.NewCustomObject(fmt.Sprintf("pk%02d", i), "common", sk2)))
+	}
+
+	common := types.NewEqualityPredicate(crud.SecondaryKey{ID: 0x0, Value: []byte("common")})
+	rare := types.NewEqualityPredicate(crud.SecondaryKey{ID: 0x1, Value: []byte("rare")})
+	rareOrNone := types.Predicate{ID: 0x1, Operator: types.In, Values: [][]byte{[]byte("rare"), []byte("none")}}
+	cases := []struct {
+		name       string
+		predicates []types.Predicate
+		start, end uint64
+		descending bool
+		expected   []string
+	}{
+		{
+			name:       "common first",
+			predicates: []types.Predicate{common, rare},
+			expected:   []string{"pk05", "pk17", "pk29"},
+		},
+		{
+			name:       "rare first",
+			predicates: []types.Predicate{rare, common},
+			expected:   []string{"pk05", "pk17", "pk29"},
+		},
+		{
+			name:       "set of values",
+			predicates: []types.Predicate{common, rareOrNone},
+			expected:   []string{"pk05", "pk17", "pk29"},
+		},
+		{
+			name:       "with range predicate",
+			predicates: []types.Predicate{{ID: 0x0, Operator: types.Prefix, Values: [][]byte{[]byte("comm")}}, common, rare},
+			expected:   []string{"pk05", "pk17", "pk29"},
+		},
+		{
+			name:       "equality and range predicate",
+			predicates: []types.Predicate{common, {ID: 0x1, Operator: types.Prefix, Values: [][]byte{[]byte("ra")}}},
+			expected:   []string{"pk05", "pk17", "pk29"},
+		},
+		{
+			name:       "equality and range predicate/descending",
+			predicates: []types.Predicate{{ID: 0x1, Operator: types.GreaterThan, Values: [][]byte{[]byte("q")}}, common},
+			descending: true,
+			expected:   []string{"pk29", "pk17", "pk05"},
+		},
+		{
+			name:       "descending range limit and offset",
+			predicates: []types.Predicate{common, rare},
+			start:      1,
+			end:        2,
+			descending: true,
+			expected:   []string{"pk17"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := types.Query{Conjunctions: []types.Conjunction{{Predicates: c.predicates}}, Start: c.start, End: c.end, Descending: c.descending}
+			it, err := store.FilterWithIterator(q, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+
+	t.Run("lookup error", func(t *testing.T) {
+		// a value which cannot be encoded
+		tooLong := types.Predicate{ID: 0x1, Operator: types.In, Values: [][]byte{[]byte("rare"), make([]byte, maxKeyLength+1)}}
+		if _, err := store.hasPrimaryKey(tooLong, []byte("pk00")); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error", err, "(expecting bad argument)")
+		}
+		// the iteration stops at the first error of the lookup
+		it := newLookupIterator(newSliceIterator([][]byte{[]byte("pk00"), []byte("pk01"), []byte("pk02")}, false), func(primaryKey []byte) (bool, error) {
+			if string(primaryKey) == "pk01" {
+				return false, crud.ErrInternal
+			}
+			return true, nil
+		})
+		if !it.Valid() || string(it.Key()) != "pk00" {
+			t.Fatal("Unexpected first key")
+		}
+		it.Next()
+		if it.Valid() {
+			t.Fatal("The iterator should have stopped")
+		}
+		if err := it.Error(); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+	})
+}
+
+func Test_filteringComposite(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := newTestStore(cdc, ctx.KVStore(key))
+	// the components of index 0x0, whose values are tuples
+	tuples := map[string][]string{
+		"pk1": {"a", "x"},
+		"pk2": {"a", "x\x00y"},
+		"pk3": {"a\x00", "x"},
+		"pk4": {"ab", "y"},
+		"pk5": {"a", "z", "extra"},
+		"pk6": {"", "x"},
+		"pk7": {"b", "a"},
+	}
+	for pk, components := range tuples {
+		values := make([][]byte, len(components))
+		for i, c := range components {
+			values[i] = []byte(c)
+		}
+		obj := test.NewCustomObject(pk, string(util.EncodeTuple(values...)), "")
+		test.CheckNoError(t, store.Index(obj))
+	}
+
+	composite := func(op types.Operator, components []string, values ...string) types.Predicate {
+		p := types.Predicate{ID: 0x0, Operator: op, Composite: true, Components: [][]byte{}}
+		for _, c := range components {
+			p.Components = append(p.Components, []byte(c))
+		}
+		for _, v := range values {
+			p.Values = append(p.Values, []byte(v))
+		}
+		return p
+	}
+	cases := []struct {
+		name       string
+		predicate  types.Predicate
+		exclusions []types.Predicate
+		expected   []string
+	}{
+		{
+			name:      "equal components",
+			predicate: composite(types.Equal, []string{"a"}, "x"),
+			expected:  []string{"pk1"},
+		},
+		{
+			name:      "equal leading component",
+			predicate: composite(types.Equal, nil, "a"),
+			expected:  []string{"pk1", "pk2", "pk5"},
+		},
+		{
+			name:      "equal components of a longer tuple",
+			predicate: composite(types.Equal, []string{"a", "z"}, "extra"),
+			expected:  []string{"pk5"},
+		},
+		{
+			name:      "prefix on leading component",
+			predicate: composite(types.Prefix, nil, "a"),
+			expected:  []string{"pk1", "pk2", "pk3", "pk4", "pk5"},
+		},
+		{
+			name:      "prefix on second component",
+			predicate: composite(types.Prefix, []string{"a"}, "x"),
+			expected:  []string{"pk1", "pk2"},
+		},
+		{
+			name:      "greater than on leading component",
+			predicate: composite(types.GreaterThan, nil, "a"),
+			expected:  []string{"pk3", "pk4", "pk7"},
+		},
+		{
+			name:      "less than on leading component",
+			predicate: composite(types.LessThan, nil, "a\x00"),
+			expected:  []string{"pk1", "pk2", "pk5", "pk6"},
+		},
+		{
+			name:      "greater than on second component",
+			predicate: composite(types.GreaterThan, []string{"a"}, "x"),
+			expected:  []string{"pk2", "pk5"},
+		},
+		{
+			name:      "greater or equal on second component",
+			predicate: composite(types.GreaterOrEqual, []string{"a"}, "x"),
+			expected:  []string{"pk1", "pk2", "pk5"},
+		},
+		{
+			name:      "less or equal on second component",
+			predicate: composite(types.LessOrEqual, []string{"a"}, "x"),
+			expected:  []string{"pk1"},
+		},
+		{
+			name:      "between on second component",
+			predicate: composite(types.Between, []string{"a"}, "x\x00", "y"),
+			expected:  []string{"pk2"},
+		},
+		{
+			name:      "in on leading component",
+			predicate: composite(types.In, nil, "ab", "b", "c"),
+			expected:  []string{"pk4", "pk7"},
+		},
+		{
+			name:       "excluded components",
+			predicate:  composite(types.Equal, nil, "a"),
+			exclusions: []types.Predicate{composite(types.Equal, []string{"a"}, "x")},
+			expected:   []string{"pk2", "pk5"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conjunction := types.Conjunction{Predicates: []types.Predicate{c.predicate}, Exclusions: c.exclusions}
+			it, err := store.FilterWithIterator(types.Query{Conjunctions: []types.Conjunction{conjunction}}, nil)
+			test.CheckNoError(t, err)
+			checkExpected(t, it.Collect(), c.expected)
+		})
+	}
+}
+
+// indexFilteringTestObjects adds some test objects to the index in order to test filtering
+func indexFilteringTestObjects(t *testing.T, store Store) {
+	objects := []test.Object{
+		test.NewCustomObject("pk4", "a2", "b3"),
+		test.NewCustomObject("pk5", "a3", "b3"),
+		test.NewCustomObject("pk2", "a2", "b2"),
+		test.NewCustomObject("pk3", "a1", "b2"),
+		test.NewCustomObject("pk1", "a1", "b1"),
+		test.NewCustomObject("pk90", "a2", "b3"),
+		test.NewCustomObject("pk7", "b1", "a1"),
+		test.NewCustomObject("pk6", "a4", "b3"),
+		test.NewCustomObject("pk8", "a4", "a4"),
+		test.NewCustomObject("pk9", "a21", "b21"),
+	}
+	for _, obj := range objects {
+		test.CheckNoError(t, store.Index(obj))
+	}
+}
+
+// indexFilteringTestAllKeys mimics the objects store containing the objects of indexFilteringTestObjects
+func indexFilteringTestAllKeys(from []byte, start, end uint64, descending bool) (types.Iterator, error) {
+	keys := []string{"pk1", "pk2", "pk3", "pk4", "pk5", "pk6", "pk7", "pk8", "pk9", "pk90"}
+	if descending {
+		keys = []string{"pk90", "pk9", "pk8", "pk7", "pk6", "pk5", "pk4", "pk3", "pk2", "pk1"}
+	}
+	for from != nil && len(keys) != 0 && util.BytesBefore([]byte(keys[0]), from, descending) {
+		keys = keys[1:]
+	}
+	return iterator.NewKeyIterator(func() ([]byte, bool) {
+		if len(keys) == 0 {
+			return nil, false
+		}
+		key := []byte(keys[0])
+		keys = keys[1:]
+		return key, true
+	}), nil
+}
+
 func checkExpected(t *testing.T, actual [][]byte, expected []string) {
 	expectedBytes := make([][]byte, len(expected))
 	for i, val := range expected {
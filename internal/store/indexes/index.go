@@ -1,42 +1,70 @@
 package indexes
 
 import (
-	"encoding/binary"
+	"bytes"
 	"fmt"
 	"math"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
 // maxKeyLength defines the index key maximum length in bytes
 const maxKeyLength = math.MaxUint16
 
-// numBytesKeyLength defines the bytes required to express the length of a key
-const numBytesKeyLength = 2
+// escapeByte is the byte that needs to be escaped in index values, as it is used in the terminator
+const escapeByte = 0x00
+
+// escapedByte is the byte following escapeByte when escapeByte is part of the index value
+const escapedByte = 0xFF
+
+// terminatorByte is the byte following escapeByte when the index value is over
+const terminatorByte = 0x01
 
 // encodeIndexKey takes a crud.SecondaryKey and encodes it
 // the way in which it's encoded is the following
-// key = <[1]byte=secondaryKey.ID><[2]byte=littleEndian(len(secondaryKey.Value))><[]byte(SecondaryKey.Value)>
-// in this way we have keys, that when iterated, do not go over domains of longer keys which contain
+// key = <[1]byte=secondaryKey.ID><[]byte=escape(SecondaryKey.Value)><[2]byte=0x00,0x01>
+// where escape replaces every 0x00 byte of the value with 0x00,0xFF.
+// In this way we have keys, that when iterated, do not go over domains of longer keys which contain
 // the key, example:
 // keyA = <0x1,0x2,0x3>
 // keyB = <0x1,0x2,0x3,0x4>
 // if we wanted to iterate over index keyA we would end up in keyB domain too
-// as keyB has, as prefix, keyA. In order to avoid this we encode keys using
-// the strategy highlighted above.
+// as keyB has, as prefix, keyA. The terminator guarantees no encoded key is the prefix of another one.
+// Moreover, as the terminator sorts before any escaped byte, encoded keys keep the byte-wise order
+// of the values they encode, which allows to iterate over a range of index values.
 // This functions treats a nil secondary key value as an empty value, and thus a nil value will be transformed into
 // an empty byte array through encode-decode
 // Error types are of types.ErrBadArgument, and happen when
-// the representation of the length of the index key takes more than 2 bytes (uint16).
+// the index key value is bigger than maxKeyLength.
 func encodeIndexKey(sk crud.SecondaryKey) ([]byte, error) {
+	key, err := encodeIndexValuePrefix(sk)
+	if err != nil {
+		return nil, err
+	}
+	return append(key, escapeByte, terminatorByte), nil
+}
+
+// encodeIndexValuePrefix encodes the secondary key like encodeIndexKey does, but without the terminator
+// so the result is the prefix of the encoded keys of all the values starting with sk.Value
+func encodeIndexValuePrefix(sk crud.SecondaryKey) ([]byte, error) {
 	length := len(sk.Value)
 	if length > maxKeyLength {
 		return nil, fmt.Errorf("%w: index keys bigger than %d bytes are not allowed, got: %d", crud.ErrBadArgument, maxKeyLength, length)
 	}
-	encodedLength := make([]byte, numBytesKeyLength)
-	binary.LittleEndian.PutUint16(encodedLength, uint16(length))
-	finalKey := append([]byte{byte(sk.ID)}, encodedLength...)
-	return append(finalKey, sk.Value...), nil
+	key := make([]byte, 1, length+3)
+	key[0] = byte(sk.ID)
+	for _, b := range sk.Value {
+		if b == escapeByte {
+			key = append(key, escapeByte, escapedByte)
+			continue
+		}
+		key = append(key, b)
+	}
+	return key, nil
 }
 
 // decodeIndexKey takes a key and tries to turn it into a secondary key
@@ -46,24 +74,139 @@ func encodeIndexKey(sk crud.SecondaryKey) ([]byte, error) {
 // it means that either state was corrupted or there is no backwards compatibility
 // between the two anymore.
 func decodeIndexKey(key []byte) (sk crud.SecondaryKey, err error) {
-	// minimumKeyLength defines the minimum length a key has to have
-	// to be converted into a secondary key
-	const metadataLength = numBytesKeyLength + 1
-	// sanity checks
-	length := len(key)
-	if length < metadataLength {
-		return sk, fmt.Errorf("%w: minimum length not reached, got: %d, want: %d", crud.ErrInternal, len(key), metadataLength)
+	length, err := encodedKeyLength(key)
+	if err != nil {
+		return sk, err
 	}
-	decodedLength := binary.LittleEndian.Uint16(key[1:3])
-	valueLength := length - metadataLength
-	if int(decodedLength) != valueLength {
-		return sk, fmt.Errorf("%w, mismatch in length, decoded: %d, got: %d", crud.ErrInternal, decodedLength, valueLength)
+	if length != len(key) {
+		return sk, fmt.Errorf("%w: unexpected data after terminator, key length: %d, encoded length: %d", crud.ErrInternal, len(key), length)
 	}
 	// create secondary key
-	value := make([]byte, length-metadataLength)
-	copy(value, key[metadataLength:])
+	value := make([]byte, 0, length-3)
+	for i := 1; i < length-2; i++ {
+		value = append(value, key[i])
+		if key[i] == escapeByte {
+			i++ // skip escaped byte, encodedKeyLength already checked it
+		}
+	}
 	return crud.SecondaryKey{
 		ID:    crud.IndexID(key[0]),
 		Value: value,
 	}, nil
 }
+
+// splitIndexKey splits a raw key of the indexes store into the encoded secondary key
+// and the primary key it points to
+func splitIndexKey(key []byte) (encodedKey, primaryKey []byte, err error) {
+	length, err := encodedKeyLength(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key[:length], key[length:], nil
+}
+
+// encodedKeyLength returns the length of the encoded secondary key the given key starts with
+func encodedKeyLength(key []byte) (int, error) {
+	// minimumKeyLength defines the minimum length a key has to have
+	// to be converted into a secondary key: id and terminator
+	const minimumKeyLength = 3
+	if len(key) < minimumKeyLength {
+		return 0, fmt.Errorf("%w: minimum length not reached, got: %d, want: %d", crud.ErrInternal, len(key), minimumKeyLength)
+	}
+	for i := 1; i < len(key)-1; i++ {
+		if key[i] != escapeByte {
+			continue
+		}
+		switch key[i+1] {
+		case terminatorByte:
+			return i + 2, nil
+		case escapedByte:
+			i++
+		default:
+			return 0, fmt.Errorf("%w: invalid escape sequence %x at position %d", crud.ErrInternal, key[i+1], i)
+		}
+	}
+	return 0, fmt.Errorf("%w: terminator not found in key %x", crud.ErrInternal, key)
+}
+
+// encodePredicateRange returns the interval [start, end[ of the indexes store
+// which contains the keys matching the given predicate
+// the predicates on a composite index are restricted to the keys starting with their leading components
+// and compare the component after them instead of the whole value.
+func encodePredicateRange(p types.Predicate) (start, end []byte, err error) {
+	// base prefixes all the keys the predicate can match
+	base := []byte{byte(p.ID)}
+	var components []byte
+	if p.Composite {
+		components = util.EncodeTuple(p.Components...)
+		base, err = encodeIndexValuePrefix(crud.SecondaryKey{ID: p.ID, Value: components})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// encodeKey encodes the i-th value of the predicate as the prefix of the keys of the values equal to it
+	encodeKey := func(i int) ([]byte, error) {
+		if len(p.Values) <= i {
+			return nil, fmt.Errorf("%w: missing value %d for operator %s", crud.ErrBadArgument, i, p.Operator)
+		}
+		if p.Composite {
+			// the value is followed by the next components, if any
+			value := util.AppendTupleComponent(components, p.Values[i])
+			return encodeIndexValuePrefix(crud.SecondaryKey{ID: p.ID, Value: value})
+		}
+		return encodeIndexKey(crud.SecondaryKey{ID: p.ID, Value: p.Values[i]})
+	}
+	// the keys we get are the first keys of a value, their end is the first key of the next value
+	var lower, upper []byte
+	switch p.Operator {
+	case types.Equal:
+		lower, err = encodeKey(0)
+		upper = sdk.PrefixEndBytes(lower)
+	case types.GreaterThan:
+		lower, err = encodeKey(0)
+		lower, upper = sdk.PrefixEndBytes(lower), sdk.PrefixEndBytes(base)
+	case types.GreaterOrEqual:
+		lower, err = encodeKey(0)
+		upper = sdk.PrefixEndBytes(base)
+	case types.LessThan:
+		lower = base
+		upper, err = encodeKey(0)
+	case types.LessOrEqual:
+		lower = base
+		upper, err = encodeKey(0)
+		upper = sdk.PrefixEndBytes(upper)
+	case types.Between:
+		lower, err = encodeKey(0)
+		if err != nil {
+			return nil, nil, err
+		}
+		upper, err = encodeKey(1)
+		upper = sdk.PrefixEndBytes(upper)
+	case types.Prefix:
+		if len(p.Values) != 1 {
+			return nil, nil, fmt.Errorf("%w: missing value 0 for operator %s", crud.ErrBadArgument, p.Operator)
+		}
+		// the encoded prefix, without terminator, prefixes the encoded keys of all the values starting with it
+		value := p.Values[0]
+		if p.Composite {
+			value = util.AppendTuplePrefix(components, value)
+		}
+		lower, err = encodeIndexValuePrefix(crud.SecondaryKey{ID: p.ID, Value: value})
+		upper = sdk.PrefixEndBytes(lower)
+	case types.Exists:
+		if len(p.Values) != 0 {
+			return nil, nil, fmt.Errorf("%w: operator %s takes no value, got %d", crud.ErrBadArgument, p.Operator, len(p.Values))
+		}
+		lower, upper = base, sdk.PrefixEndBytes(base)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown operator %s", crud.ErrBadArgument, p.Operator)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// an empty interval is not an error, it simply matches nothing
+	if upper != nil && bytes.Compare(lower, upper) > 0 {
+		upper = lower
+	}
+	return lower, upper, nil
+}
@@ -115,29 +115,104 @@ func Test_encodeDecodeIndexKey(t *testing.T) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
-	t.Run("decode/error length too small", func(t *testing.T) {
+	t.Run("decode/error invalid escape", func(t *testing.T) {
 		key := []byte{
 			0x0, // byte: id byte
-			0x0, // byte: length byte 0
-			0x0, // byte: length byte 1
 			0x1, // byte: key 1
+			0x0, // byte: escape byte
+			0x2, // byte: neither escaped byte nor terminator
+			0x0, // byte: terminator byte 0
+			0x1, // byte: terminator byte 1
 		}
 		_, err := decodeIndexKey(key)
 		if !errors.Is(err, crud.ErrInternal) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
-
-	t.Run("decode/error length too big", func(t *testing.T) {
+	t.Run("decode/error missing terminator", func(t *testing.T) {
+		key := []byte{
+			0x0,  // byte: id byte
+			0x1,  // byte: key 1
+			0x0,  // byte: escape byte
+			0xFF, // byte: escaped byte
+		}
+		_, err := decodeIndexKey(key)
+		if !errors.Is(err, crud.ErrInternal) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("decode/error data after terminator", func(t *testing.T) {
 		key := []byte{
 			0x0, // byte: id byte
-			0x0, // byte: length byte 0
-			0x2, // byte: length byte 1
 			0x1, // byte: key 1
+			0x0, // byte: terminator byte 0
+			0x1, // byte: terminator byte 1
+			0x1, // byte: extra byte
 		}
 		_, err := decodeIndexKey(key)
 		if !errors.Is(err, crud.ErrInternal) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
+	t.Run("encode/escaped values", func(t *testing.T) {
+		sk := crud.SecondaryKey{
+			ID:    0x2,
+			Value: []byte{0x0, 0x1, 0x0, 0x0, 0xFF},
+		}
+		key, err := encodeIndexKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeIndexKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sk, decoded) {
+			t.Fatalf("unexpected result: want: %s, got: %s", sk, decoded)
+		}
+	})
+	t.Run("encode/order preservation", func(t *testing.T) {
+		// values sorted in ascending order
+		values := [][]byte{
+			{},
+			{0x0},
+			{0x0, 0x0},
+			{0x0, 0x1},
+			{0x1},
+			[]byte("a"),
+			[]byte("a\x00"),
+			[]byte("a\x00b"),
+			[]byte("aa"),
+			[]byte("ab"),
+			[]byte("b"),
+			{0xFF},
+			{0xFF, 0x0},
+		}
+		var previous []byte
+		for i, v := range values {
+			key, err := encodeIndexKey(crud.SecondaryKey{ID: 0x1, Value: v})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i > 0 && bytes.Compare(previous, key) >= 0 {
+				t.Fatalf("order not preserved between %x and %x: %x >= %x", values[i-1], v, previous, key)
+			}
+			previous = key
+		}
+	})
+	t.Run("split", func(t *testing.T) {
+		sk := crud.SecondaryKey{ID: 0x1, Value: []byte{0x1, 0x0, 0x1}}
+		encoded, err := encodeIndexKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		primaryKey := []byte{0x0, 0x1, 0x0}
+		gotEncoded, gotPrimaryKey, err := splitIndexKey(append(append([]byte{}, encoded...), primaryKey...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotEncoded, encoded) || !bytes.Equal(gotPrimaryKey, primaryKey) {
+			t.Fatalf("unexpected result: want: %x %x, got: %x %x", encoded, primaryKey, gotEncoded, gotPrimaryKey)
+		}
+	})
 }
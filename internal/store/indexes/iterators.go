@@ -0,0 +1,505 @@
+package indexes
+
+import (
+	"bytes"
+	"container/heap"
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
+)
+
+// pkIterator iterates over primary keys in ascending or descending order
+type pkIterator interface {
+	// Valid returns false once the iterator is consumed
+	Valid() bool
+	// Key returns the current primary key
+	Key() []byte
+	// Next moves to the next primary key
+	Next()
+	// Close releases the resources held by the iterator
+	Close() error
+	// Error returns the error which stopped the iteration before its end, if any
+	Error() error
+}
+
+// positionedIterator is a pkIterator whose position in the iteration is not its current primary key
+type positionedIterator interface {
+	pkIterator
+	// Position returns the position of the current primary key, which can be used to resume the iteration
+	Position() []byte
+}
+
+// iteratorPosition returns the position of the current primary key of the iterator
+func iteratorPosition(it pkIterator) []byte {
+	if positioned, ok := it.(positionedIterator); ok {
+		return positioned.Position()
+	}
+	return it.Key()
+}
+
+// seekIterator is a pkIterator which can move forward to a primary key without going through the keys before it
+type seekIterator interface {
+	pkIterator
+	// Seek moves the iterator to the first primary key which does not come before the given one in the iteration order
+	// the iterator does not move if its current primary key does not come before the given one
+	Seek(primaryKey []byte)
+}
+
+// seek moves the iterator to the first primary key which does not come before the given one in the iteration order
+// the iterators which cannot seek go through the keys before it
+func seek(it pkIterator, primaryKey []byte, descending bool) {
+	if seeker, ok := it.(seekIterator); ok {
+		seeker.Seek(primaryKey)
+		return
+	}
+	for it.Valid() && util.BytesBefore(it.Key(), primaryKey, descending) {
+		it.Next()
+	}
+}
+
+// gallopSteps is the number of keys a storeIterator goes through before reopening its iterator when seeking
+// as reopening an iterator costs more than going to the next key, close keys are reached by iterating
+const gallopSteps = 4
+
+// storeIterator is a pkIterator over the keys of a store, it seeks by reopening the store iterator at the sought key
+type storeIterator struct {
+	sdk.Iterator
+	kv         sdk.KVStore
+	descending bool
+}
+
+// newStoreIterator returns an iterator over the keys of the store from the key from included
+func newStoreIterator(kv sdk.KVStore, from []byte, descending bool) *storeIterator {
+	it := &storeIterator{kv: kv, descending: descending}
+	it.open(from)
+	return it
+}
+
+func (it *storeIterator) open(from []byte) {
+	start, end := util.IteratorBounds(from, it.descending)
+	if it.descending {
+		it.Iterator = it.kv.ReverseIterator(start, end)
+		return
+	}
+	it.Iterator = it.kv.Iterator(start, end)
+}
+
+func (it *storeIterator) Seek(primaryKey []byte) {
+	for i := 0; i < gallopSteps; i++ {
+		if !it.Valid() || !util.BytesBefore(it.Key(), primaryKey, it.descending) {
+			return
+		}
+		it.Next()
+	}
+	if !it.Valid() || !util.BytesBefore(it.Key(), primaryKey, it.descending) {
+		return
+	}
+	_ = it.Iterator.Close()
+	it.open(primaryKey)
+}
+
+// Error returns nil, as the kv store iterators panic on failures and the prefix store iterators
+// return an error from their Error method once they are consumed
+func (it *storeIterator) Error() error {
+	return nil
+}
+
+// sliceIterator is a pkIterator over an in memory set of primary keys
+type sliceIterator struct {
+	keys       [][]byte
+	descending bool
+}
+
+// newSliceIterator sorts the given primary keys in the given order and removes
+// the duplicates before building an iterator over them
+func newSliceIterator(keys [][]byte, descending bool) *sliceIterator {
+	util.SortByteSlice(keys)
+	n := 0
+	for i, key := range keys {
+		if i > 0 && bytes.Equal(key, keys[n-1]) {
+			continue
+		}
+		keys[n] = key
+		n++
+	}
+	keys = keys[:n]
+	if descending {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	return &sliceIterator{keys: keys, descending: descending}
+}
+
+func (it *sliceIterator) Valid() bool {
+	return len(it.keys) != 0
+}
+
+func (it *sliceIterator) Key() []byte {
+	return it.keys[0]
+}
+
+func (it *sliceIterator) Next() {
+	it.keys = it.keys[1:]
+}
+
+func (it *sliceIterator) Close() error {
+	it.keys = nil
+	return nil
+}
+
+func (it *sliceIterator) Error() error {
+	return nil
+}
+
+// Seek looks the primary key up by binary search, as the keys are sorted in the iteration order
+func (it *sliceIterator) Seek(primaryKey []byte) {
+	i := sort.Search(len(it.keys), func(i int) bool {
+		return !util.BytesBefore(it.keys[i], primaryKey, it.descending)
+	})
+	it.keys = it.keys[i:]
+}
+
+// closeAll closes all the given iterators
+func closeAll(iters []pkIterator) {
+	for _, it := range iters {
+		_ = it.Close()
+	}
+}
+
+// firstError returns the first error of the given iterators, if any
+func firstError(iters []pkIterator) error {
+	for _, it := range iters {
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// intersectionIterator yields the primary keys present in all of its iterators
+type intersectionIterator struct {
+	iters      []pkIterator
+	descending bool
+	key        []byte
+	valid      bool
+}
+
+func newIntersectionIterator(iters []pkIterator, descending bool) *intersectionIterator {
+	it := &intersectionIterator{iters: iters, descending: descending}
+	it.moveForward()
+	return it
+}
+
+func (it *intersectionIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *intersectionIterator) Key() []byte {
+	return it.key
+}
+
+// Next moves the first iterator past the current key, the others will seek the next candidate key
+func (it *intersectionIterator) Next() {
+	if !it.valid {
+		return
+	}
+	it.iters[0].Next()
+	it.moveForward()
+}
+
+func (it *intersectionIterator) moveForward() {
+	var stop bool
+	it.key, stop = moveForward(it.iters, it.descending)
+	it.valid = !stop
+}
+
+func (it *intersectionIterator) Close() error {
+	closeAll(it.iters)
+	it.valid = false
+	return nil
+}
+
+func (it *intersectionIterator) Error() error {
+	return firstError(it.iters)
+}
+
+// unionIterator yields the primary keys present in any of its iterators, without duplicates
+type unionIterator struct {
+	iters      []pkIterator
+	descending bool
+	key        []byte
+	valid      bool
+}
+
+func newUnionIterator(iters []pkIterator, descending bool) *unionIterator {
+	it := &unionIterator{iters: iters, descending: descending}
+	it.findFirst()
+	return it
+}
+
+func (it *unionIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *unionIterator) Key() []byte {
+	return it.key
+}
+
+// Next moves forward all the iterators positioned on the current key, so it is not yielded twice
+func (it *unionIterator) Next() {
+	for _, iter := range it.iters {
+		if iter.Valid() && bytes.Equal(iter.Key(), it.key) {
+			iter.Next()
+		}
+	}
+	it.findFirst()
+}
+
+func (it *unionIterator) Close() error {
+	closeAll(it.iters)
+	it.valid = false
+	return nil
+}
+
+func (it *unionIterator) Error() error {
+	return firstError(it.iters)
+}
+
+// Seek makes all the iterators seek the primary key, so that a union of seekable iterators is seekable
+func (it *unionIterator) Seek(primaryKey []byte) {
+	for _, iter := range it.iters {
+		seek(iter, primaryKey, it.descending)
+	}
+	it.findFirst()
+}
+
+// findFirst sets the current key to the key of the iterators which comes first in the iteration order
+func (it *unionIterator) findFirst() {
+	it.key, it.valid = nil, false
+	for _, iter := range it.iters {
+		if !iter.Valid() {
+			continue
+		}
+		if !it.valid || util.BytesBefore(iter.Key(), it.key, it.descending) {
+			it.key, it.valid = iter.Key(), true
+		}
+	}
+}
+
+// mergeIterator yields the primary keys present in any of its iterators, without duplicates, as unionIterator does
+// its iterators are kept in a heap ordered by their current primary key, so that merging many iterators,
+// such as the ones of all the values in a range of an index, costs a logarithmic time per primary key
+type mergeIterator struct {
+	heap iteratorHeap
+	// iters are all the iterators, including the consumed ones which left the heap
+	iters []pkIterator
+}
+
+func newMergeIterator(iters []pkIterator, descending bool) *mergeIterator {
+	it := &mergeIterator{heap: iteratorHeap{descending: descending}, iters: iters}
+	it.init()
+	return it
+}
+
+// init builds the heap from the iterators which are not consumed
+func (it *mergeIterator) init() {
+	it.heap.iters = it.heap.iters[:0]
+	for _, iter := range it.iters {
+		if iter.Valid() {
+			it.heap.iters = append(it.heap.iters, iter)
+		}
+	}
+	heap.Init(&it.heap)
+}
+
+func (it *mergeIterator) Valid() bool {
+	return it.heap.Len() != 0
+}
+
+func (it *mergeIterator) Key() []byte {
+	return it.heap.iters[0].Key()
+}
+
+// Next moves forward all the iterators positioned on the current key, so it is not yielded twice
+func (it *mergeIterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	key := it.Key()
+	for it.Valid() && bytes.Equal(it.heap.iters[0].Key(), key) {
+		top := it.heap.iters[0]
+		top.Next()
+		if top.Valid() {
+			heap.Fix(&it.heap, 0)
+		} else {
+			heap.Pop(&it.heap)
+		}
+	}
+}
+
+// Seek makes all the iterators seek the primary key, so that a merge of seekable iterators is seekable
+func (it *mergeIterator) Seek(primaryKey []byte) {
+	if !it.Valid() || !util.BytesBefore(it.Key(), primaryKey, it.heap.descending) {
+		return
+	}
+	for _, iter := range it.heap.iters {
+		seek(iter, primaryKey, it.heap.descending)
+	}
+	it.init()
+}
+
+func (it *mergeIterator) Close() error {
+	closeAll(it.iters)
+	it.heap.iters = nil
+	return nil
+}
+
+func (it *mergeIterator) Error() error {
+	return firstError(it.iters)
+}
+
+// iteratorHeap implements heap.Interface for valid iterators, the first one being on the first primary key
+type iteratorHeap struct {
+	iters      []pkIterator
+	descending bool
+}
+
+func (h iteratorHeap) Len() int {
+	return len(h.iters)
+}
+
+func (h iteratorHeap) Less(i, j int) bool {
+	return util.BytesBefore(h.iters[i].Key(), h.iters[j].Key(), h.descending)
+}
+
+func (h iteratorHeap) Swap(i, j int) {
+	h.iters[i], h.iters[j] = h.iters[j], h.iters[i]
+}
+
+func (h *iteratorHeap) Push(x interface{}) {
+	h.iters = append(h.iters, x.(pkIterator))
+}
+
+func (h *iteratorHeap) Pop() interface{} {
+	n := len(h.iters) - 1
+	last := h.iters[n]
+	h.iters = h.iters[:n]
+	return last
+}
+
+// differenceIterator yields the primary keys of its included iterator which are not in its excluded iterator
+type differenceIterator struct {
+	included   pkIterator
+	excluded   pkIterator
+	descending bool
+}
+
+func newDifferenceIterator(included, excluded pkIterator, descending bool) *differenceIterator {
+	it := &differenceIterator{included: included, excluded: excluded, descending: descending}
+	it.skipExcluded()
+	return it
+}
+
+func (it *differenceIterator) Valid() bool {
+	return it.included.Valid()
+}
+
+func (it *differenceIterator) Key() []byte {
+	return it.included.Key()
+}
+
+func (it *differenceIterator) Next() {
+	it.included.Next()
+	it.skipExcluded()
+}
+
+func (it *differenceIterator) Close() error {
+	_ = it.excluded.Close()
+	return it.included.Close()
+}
+
+func (it *differenceIterator) Error() error {
+	return firstError([]pkIterator{it.included, it.excluded})
+}
+
+// skipExcluded moves the included iterator forward until its key is not excluded
+// both iterators being ordered, the excluded one never has to go backwards
+func (it *differenceIterator) skipExcluded() {
+	for it.included.Valid() {
+		key := it.included.Key()
+		seek(it.excluded, key, it.descending)
+		if !it.excluded.Valid() || !bytes.Equal(it.excluded.Key(), key) {
+			return
+		}
+		it.included.Next()
+	}
+}
+
+// lookupIterator yields the primary keys of its iterator which are accepted by its lookup function
+// the iteration stops at the first error of the lookup function
+type lookupIterator struct {
+	iter   pkIterator
+	accept func(primaryKey []byte) (bool, error)
+	err    error
+}
+
+func newLookupIterator(iter pkIterator, accept func(primaryKey []byte) (bool, error)) *lookupIterator {
+	it := &lookupIterator{iter: iter, accept: accept}
+	it.skipRejected()
+	return it
+}
+
+func (it *lookupIterator) Valid() bool {
+	return it.err == nil && it.iter.Valid()
+}
+
+func (it *lookupIterator) Key() []byte {
+	return it.iter.Key()
+}
+
+func (it *lookupIterator) Next() {
+	it.iter.Next()
+	it.skipRejected()
+}
+
+func (it *lookupIterator) Close() error {
+	return it.iter.Close()
+}
+
+func (it *lookupIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.iter.Error()
+}
+
+// skipRejected moves the iterator forward until its key is accepted
+func (it *lookupIterator) skipRejected() {
+	for ; it.iter.Valid(); it.iter.Next() {
+		ok, err := it.accept(it.iter.Key())
+		if err != nil {
+			it.err = err
+			return
+		}
+		if ok {
+			return
+		}
+	}
+}
+
+// iteratorAdapter turns a types.Iterator into a pkIterator
+type iteratorAdapter struct {
+	types.Iterator
+}
+
+func (it iteratorAdapter) Key() []byte {
+	return it.Get()
+}
+
+func (it iteratorAdapter) Close() error {
+	return nil
+}
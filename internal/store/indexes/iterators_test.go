@@ -0,0 +1,105 @@
+package indexes
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/iov-one/cosmos-sdk-crud/internal/test"
+)
+
+func Test_seek(t *testing.T) {
+	ctx, key, _, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	kv := ctx.KVStore(key)
+	var keys [][]byte
+	for i := 0; i < 20; i += 2 {
+		k := []byte(fmt.Sprintf("pk%02d", i))
+		keys = append(keys, k)
+		kv.Set(k, []byte{})
+	}
+	iterators := map[string]func(descending bool) pkIterator{
+		"slice": func(descending bool) pkIterator {
+			return newSliceIterator(append([][]byte{}, keys...), descending)
+		},
+		"store": func(descending bool) pkIterator {
+			return newStoreIterator(kv, nil, descending)
+		},
+		"union": func(descending bool) pkIterator {
+			return newUnionIterator([]pkIterator{
+				newSliceIterator([][]byte{keys[0], keys[2], keys[4], keys[6], keys[8]}, descending),
+				newStoreIterator(kv, nil, descending),
+			}, descending)
+		},
+		"merge": func(descending bool) pkIterator {
+			return newMergeIterator([]pkIterator{
+				newSliceIterator([][]byte{keys[0], keys[4], keys[8]}, descending),
+				newSliceIterator([][]byte{keys[1], keys[4], keys[6], keys[9]}, descending),
+				newStoreIterator(kv, nil, descending),
+				newSliceIterator(nil, descending),
+			}, descending)
+		},
+		"not seekable": func(descending bool) pkIterator {
+			return newLookupIterator(newSliceIterator(append([][]byte{}, keys...), descending), func([]byte) (bool, error) { return true, nil })
+		},
+	}
+	cases := []struct {
+		name       string
+		seeks      []string
+		descending bool
+		expected   []string
+	}{
+		{
+			name:     "existing key",
+			seeks:    []string{"pk04"},
+			expected: []string{"pk04", "pk06", "pk08", "pk10", "pk12", "pk14", "pk16", "pk18"},
+		},
+		{
+			name:     "missing key",
+			seeks:    []string{"pk13"},
+			expected: []string{"pk14", "pk16", "pk18"},
+		},
+		{
+			name:     "backwards",
+			seeks:    []string{"pk15", "pk03"},
+			expected: []string{"pk16", "pk18"},
+		},
+		{
+			name:     "after the last key",
+			seeks:    []string{"pk19"},
+			expected: []string{},
+		},
+		{
+			name:       "descending/existing key",
+			seeks:      []string{"pk04"},
+			descending: true,
+			expected:   []string{"pk04", "pk02", "pk00"},
+		},
+		{
+			name:       "descending/missing key",
+			seeks:      []string{"pk13", "pk09"},
+			descending: true,
+			expected:   []string{"pk08", "pk06", "pk04", "pk02", "pk00"},
+		},
+	}
+	for name, newIterator := range iterators {
+		for _, c := range cases {
+			t.Run(fmt.Sprintf("%s/%s", name, c.name), func(t *testing.T) {
+				it := newIterator(c.descending)
+				defer it.Close()
+				for _, k := range c.seeks {
+					seek(it, []byte(k), c.descending)
+				}
+				actual := []string{}
+				for ; it.Valid(); it.Next() {
+					actual = append(actual, string(it.Key()))
+				}
+				if !reflect.DeepEqual(actual, c.expected) {
+					t.Fatal("Unexpected keys after seeking (expected :", c.expected, ", actual :", actual, ")")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package indexes
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
+)
+
+// keyRange is an interval [start, end[ of encoded secondary keys
+type keyRange struct {
+	start, end []byte
+}
+
+// contains checks if the encoded key is in the interval
+func (r keyRange) contains(encodedKey []byte) bool {
+	return bytes.Compare(encodedKey, r.start) >= 0 && bytes.Compare(encodedKey, r.end) < 0
+}
+
+// predicateMatcher checks a predicate against the encoded secondary keys of an object
+// the predicate is respected if any of the keys is in any of its ranges
+type predicateMatcher []keyRange
+
+func newPredicateMatcher(p types.Predicate) (predicateMatcher, error) {
+	// a set of values is the union of the equalities on each of them
+	predicates := []types.Predicate{p}
+	if p.Operator == types.In {
+		predicates = make([]types.Predicate, len(p.Values))
+		for i, v := range p.Values {
+			predicates[i] = p
+			predicates[i].Operator, predicates[i].Values = types.Equal, [][]byte{v}
+		}
+	}
+	m := make(predicateMatcher, len(predicates))
+	for i, predicate := range predicates {
+		start, end, err := encodePredicateRange(predicate)
+		if err != nil {
+			return nil, err
+		}
+		m[i] = keyRange{start: start, end: end}
+	}
+	return m, nil
+}
+
+func (m predicateMatcher) match(encodedKeys [][]byte) bool {
+	for _, encodedKey := range encodedKeys {
+		for _, r := range m {
+			if r.contains(encodedKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conjunctionMatcher checks a conjunction against the encoded secondary keys of an object
+type conjunctionMatcher struct {
+	predicates []predicateMatcher
+	exclusions []predicateMatcher
+}
+
+func newConjunctionMatcher(conjunction types.Conjunction) (m conjunctionMatcher, err error) {
+	if len(conjunction.Predicates) == 0 && len(conjunction.Exclusions) == 0 {
+		return m, fmt.Errorf("%w: empty conjunction", crud.ErrBadArgument)
+	}
+	m.predicates, err = newPredicateMatchers(conjunction.Predicates)
+	if err != nil {
+		return m, err
+	}
+	m.exclusions, err = newPredicateMatchers(conjunction.Exclusions)
+	return m, err
+}
+
+func newPredicateMatchers(predicates []types.Predicate) ([]predicateMatcher, error) {
+	matchers := make([]predicateMatcher, len(predicates))
+	for i, p := range predicates {
+		m, err := newPredicateMatcher(p)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	return matchers, nil
+}
+
+func (m conjunctionMatcher) match(encodedKeys [][]byte) bool {
+	for _, p := range m.predicates {
+		if !p.match(encodedKeys) {
+			return false
+		}
+	}
+	for _, p := range m.exclusions {
+		if p.match(encodedKeys) {
+			return false
+		}
+	}
+	return true
+}
+
+// postingListLimit is the maximum number of objects the equalities of a query ordered by an index can select
+// for the objects to be read from the equalities instead of walking the index
+const postingListLimit = 1024
+
+// orderedIterator yields the primary keys of the objects having a value for an index
+// in the order of their index values, objects sharing the same value are yielded in primary key order.
+// Only the objects matching at least one of the conjunctions are yielded, all of them if there is none.
+type orderedIterator struct {
+	store        Store
+	iter         sdk.Iterator
+	id           crud.IndexID
+	descending   bool
+	conjunctions []conjunctionMatcher
+	primaryKey   []byte
+	// err is the error which stopped the iteration
+	err error
+}
+
+// orderedIterator returns an iterator over the primary keys matching the query, ordered by the values of the index id.
+// If every conjunction has an equality or a set of values selecting, along with the ones of the other conjunctions,
+// at most postingListLimit objects, the objects are read from the index keys of these values and sorted in memory.
+// Otherwise the conjunctions are checked against the secondary keys of each object met while walking the index,
+// whose cost grows with the number of objects having a value for the index.
+// The iteration starts from the position from, if not nil, which must be a position returned by such an iterator.
+func (s Store) orderedIterator(id crud.IndexID, conjunctions []types.Conjunction, from []byte, descending bool) (pkIterator, error) {
+	if from != nil && (len(from) == 0 || from[0] != byte(id)) {
+		return nil, fmt.Errorf("%w: position %x is not in index %d", crud.ErrBadArgument, from, id)
+	}
+	matchers := make([]conjunctionMatcher, len(conjunctions))
+	for i, conjunction := range conjunctions {
+		m, err := newConjunctionMatcher(conjunction)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	postingLists, ok, err := s.postingLists(conjunctions)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return s.postingListIterator(id, matchers, postingLists, from, descending)
+	}
+	return s.walkingIterator(id, matchers, from, descending), nil
+}
+
+// postingLists returns, for each conjunction, its equality or set of values matching the fewest objects
+// ok is false if a conjunction has none or if they select more than postingListLimit objects
+func (s Store) postingLists(conjunctions []types.Conjunction) (predicates []types.Predicate, ok bool, err error) {
+	if len(conjunctions) == 0 {
+		return nil, false, nil
+	}
+	var total uint64
+	for _, conjunction := range conjunctions {
+		cheapest, cheapestCost := -1, uint64(unknownCost)
+		for i, p := range conjunction.Predicates {
+			if !matchesValues(p) {
+				continue
+			}
+			cost, err := s.predicateCost(p)
+			if err != nil {
+				return nil, false, err
+			}
+			if cheapest == -1 || cost < cheapestCost {
+				cheapest, cheapestCost = i, cost
+			}
+		}
+		if cheapest == -1 {
+			return nil, false, nil
+		}
+		total += cheapestCost
+		if total > postingListLimit {
+			return nil, false, nil
+		}
+		predicates = append(predicates, conjunction.Predicates[cheapest])
+	}
+	return predicates, true, nil
+}
+
+// postingListIterator returns an iterator over the primary keys pointed by the index keys of the values of the predicates
+// which match the conjunctions, in the order of their values for the index id, as orderedIterator would yield them
+func (s Store) postingListIterator(id crud.IndexID, matchers []conjunctionMatcher, predicates []types.Predicate, from []byte, descending bool) (pkIterator, error) {
+	seen := make(map[string]struct{})
+	var keys []positionedKey
+	for _, p := range predicates {
+		iter, err := s.predicateIterator(p, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		for ; iter.Valid(); iter.Next() {
+			primaryKey := append([]byte{}, iter.Key()...)
+			if _, ok := seen[string(primaryKey)]; ok {
+				continue
+			}
+			seen[string(primaryKey)] = struct{}{}
+			encodedKeys, err := s.getIndexList(primaryKey)
+			if err != nil {
+				_ = iter.Close()
+				return nil, fmt.Errorf("%w: index list of primary key %x: %s", crud.ErrInternal, primaryKey, err)
+			}
+			if !matchAny(matchers, encodedKeys) {
+				continue
+			}
+			// the object is yielded for its first value in the iteration order, as the walking iterator does
+			var first []byte
+			for _, encodedKey := range encodedKeys {
+				if encodedKey[0] == byte(id) && (first == nil || util.BytesBefore(encodedKey, first, descending)) {
+					first = encodedKey
+				}
+			}
+			if first == nil {
+				continue
+			}
+			position := append(append([]byte{}, first...), primaryKey...)
+			if from != nil && util.BytesBefore(position, from, descending) {
+				continue
+			}
+			keys = append(keys, positionedKey{position: position, primaryKey: primaryKey})
+		}
+		err = iter.Error()
+		_ = iter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return util.BytesBefore(keys[i].position, keys[j].position, descending)
+	})
+	return &positionedSliceIterator{keys: keys}, nil
+}
+
+// positionedKey is a primary key along with the index key it is yielded at
+type positionedKey struct {
+	position   []byte
+	primaryKey []byte
+}
+
+// positionedSliceIterator is a positionedIterator over an in memory set of primary keys sorted by position
+type positionedSliceIterator struct {
+	keys []positionedKey
+}
+
+func (it *positionedSliceIterator) Valid() bool {
+	return len(it.keys) != 0
+}
+
+func (it *positionedSliceIterator) Key() []byte {
+	return it.keys[0].primaryKey
+}
+
+func (it *positionedSliceIterator) Position() []byte {
+	return it.keys[0].position
+}
+
+func (it *positionedSliceIterator) Next() {
+	it.keys = it.keys[1:]
+}
+
+func (it *positionedSliceIterator) Close() error {
+	it.keys = nil
+	return nil
+}
+
+func (it *positionedSliceIterator) Error() error {
+	return nil
+}
+
+// walkingIterator returns an iterator walking the index id, which yields the primary keys of the objects
+// matching the conjunctions
+func (s Store) walkingIterator(id crud.IndexID, matchers []conjunctionMatcher, from []byte, descending bool) pkIterator {
+	start := []byte{byte(id)}
+	end := sdk.PrefixEndBytes(start)
+	var iter sdk.Iterator
+	if descending {
+		if from != nil {
+			_, end = util.IteratorBounds(from, descending)
+		}
+		iter = s.indexes.ReverseIterator(start, end)
+	} else {
+		if from != nil {
+			start = from
+		}
+		iter = s.indexes.Iterator(start, end)
+	}
+	it := &orderedIterator{
+		store:        s,
+		iter:         iter,
+		id:           id,
+		descending:   descending,
+		conjunctions: matchers,
+	}
+	it.skipUnmatched()
+	return it
+}
+
+func (it *orderedIterator) Valid() bool {
+	return it.err == nil && it.iter.Valid()
+}
+
+func (it *orderedIterator) Key() []byte {
+	return it.primaryKey
+}
+
+// Position returns the index key the iterator is on, as the primary key does not define its position in the index
+func (it *orderedIterator) Position() []byte {
+	return it.iter.Key()
+}
+
+func (it *orderedIterator) Next() {
+	it.iter.Next()
+	it.skipUnmatched()
+}
+
+func (it *orderedIterator) Close() error {
+	return it.iter.Close()
+}
+
+func (it *orderedIterator) Error() error {
+	return it.err
+}
+
+// skipUnmatched moves the index iterator forward until it points to an object matching the conditions
+// an object having several values for the index is only yielded for the first of them in the iteration order
+// the iteration stops if the index keys or the index list of an object cannot be read, which is state corruption
+func (it *orderedIterator) skipUnmatched() {
+	for ; it.iter.Valid(); it.iter.Next() {
+		encodedKey, primaryKey, err := splitIndexKey(it.iter.Key())
+		if err != nil {
+			it.err = err
+			return
+		}
+		encodedKeys, err := it.store.getIndexList(primaryKey)
+		if err != nil {
+			it.err = fmt.Errorf("%w: index list of primary key %x: %s", crud.ErrInternal, primaryKey, err)
+			return
+		}
+		if it.seenBefore(encodedKey, encodedKeys) || !it.match(encodedKeys) {
+			continue
+		}
+		it.primaryKey = primaryKey
+		return
+	}
+}
+
+// seenBefore checks if the object has a value for the index which comes before the current one in the iteration order
+func (it *orderedIterator) seenBefore(current []byte, encodedKeys [][]byte) bool {
+	for _, encodedKey := range encodedKeys {
+		if encodedKey[0] != byte(it.id) {
+			continue
+		}
+		cmp := bytes.Compare(encodedKey, current)
+		if (cmp < 0 && !it.descending) || (cmp > 0 && it.descending) {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks if the object matches at least one of the conjunctions
+func (it *orderedIterator) match(encodedKeys [][]byte) bool {
+	return matchAny(it.conjunctions, encodedKeys)
+}
+
+// matchAny checks if the encoded secondary keys of an object match at least one of the conjunctions, or if there is none
+func matchAny(conjunctions []conjunctionMatcher, encodedKeys [][]byte) bool {
+	if len(conjunctions) == 0 {
+		return true
+	}
+	for _, conjunction := range conjunctions {
+		if conjunction.match(encodedKeys) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package indexes
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/cosmos/cosmos-sdk/codec"
@@ -8,6 +9,8 @@ import (
 	sdk "github.com/cosmos/cosmos-sdk/types"
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/metadata"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/ranks"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
@@ -21,6 +24,9 @@ const indexesPrefix = 0x0
 // primaryKeysToIndexPrefix is the prefix used to map primary keys to indexes
 const primaryKeysToIndexPrefix = 0x1
 
+// uniqueValuesPrefix is the prefix used to map the values of the unique indexes to their primary key
+const uniqueValuesPrefix = 0x2
+
 // Store defines the index store, it store mappings from indexes
 // to primary keys, and mappings of primary keys to their respective
 // index values
@@ -30,26 +36,37 @@ type Store struct {
 	// indexes maps secondary keys to their primary keys
 	// index and primary keys are stored using the following pattern
 	// the index key is composed as
-	// <ID><Length of index key value in little endian><IndexKeyValue>
+	// <ID><Escaped IndexKeyValue><Terminator>
 	// where ID defines the unique identifier of the index (example, Location with index id which equals 0x0)
-	// Length is the length of the index key value
 	// IndexKeyValue is the value of the index we're mapping primary keys to, for example (Location) Italy
+	// its 0x00 bytes are escaped so that the terminator (0x00,0x01) marks the end of the value
 	// So when we're storing objects which we want to index by their Location the following KVStore forms
 	// considering Italy as location
 	// we get the following prefixed store:
-	// <ID=0x0><LengthOfIndexValue=5><italy>
+	// <ID=0x0><italy><0x00,0x01>
 	// and we start saving primary keys as keys in the store, with value []byte{}
 	// so, in the store, what we get is the following
-	// <ID=0x0><LengthOfIndexValue=5><italy> PrimaryKey_A
-	// <ID=0x0><LengthOfIndexValue=5><italy> PrimaryKey_B
+	// <ID=0x0><italy><0x00,0x01> PrimaryKey_A
+	// <ID=0x0><italy><0x00,0x01> PrimaryKey_B
 	// so if we want to get all the objects which have Italy as index value
 	// we just prefix the store using the index key value = italy
 	// and we automatically get access to all the primary keys required
+	// As the encoding preserves the order of the values, the objects whose index value
+	// is in a given interval can be found by iterating over an interval of the store.
 	indexes sdk.KVStore
 	// primaryKeysIndexes store the encoded secondary keys values of an object
 	// using its primary key as key in the store. This allows us to quickly update
 	// or get rid of indexes while updating or deleting an object from the store.
 	primaryKeysIndexes sdk.KVStore
+	// uniqueValues maps the encoded secondary keys of the unique indexes to the primary key
+	// of the object they point to, so that a value is checked to be unique with a single read
+	uniqueValues sdk.KVStore
+	// metadata keeps track of the number of objects each index key points to
+	metadata metadata.Store
+	// ranks allows to find the primary key at a given rank for an index key, nil if the ranks are not maintained
+	ranks *ranks.Store
+	// unique is the set of the indexes whose values can point to a single object
+	unique map[crud.IndexID]struct{}
 }
 
 // NewStore builds the required prefixed stores used by the index store
@@ -57,46 +74,145 @@ type Store struct {
 // and the other which maps a primary key to its respective index key
 // for a more straight forward delete of indexes which does not require
 // acquiring the objects current state when indexes are updated.
-func NewStore(cdc codec.Codec, db sdk.KVStore) Store {
+// The number of objects per index key is maintained in the given metadata store,
+// and the ranks of the primary keys per index key in the given ranks store, if not nil.
+// The values of the unique indexes can only point to a single object.
+func NewStore(cdc codec.Codec, db sdk.KVStore, metadata metadata.Store, ranks *ranks.Store, uniqueIndexes []crud.IndexID) Store {
+	unique := make(map[crud.IndexID]struct{}, len(uniqueIndexes))
+	for _, id := range uniqueIndexes {
+		unique[id] = struct{}{}
+	}
 	return Store{
 		cdc:                cdc,
 		indexes:            prefix.NewStore(db, []byte{indexesPrefix}),
 		primaryKeysIndexes: prefix.NewStore(db, []byte{primaryKeysToIndexPrefix}),
+		uniqueValues:       prefix.NewStore(db, []byte{uniqueValuesPrefix}),
+		metadata:           metadata,
+		ranks:              ranks,
+		unique:             unique,
+	}
+}
+
+// IsUnique tells if the values of the given index can only point to a single object
+func (s Store) IsUnique(id crud.IndexID) bool {
+	_, ok := s.unique[id]
+	return ok
+}
+
+// CheckUnique checks that no other object has the same values as the given object for the unique indexes
+// it returns a *crud.UniqueViolationError naming the conflicting object otherwise
+func (s Store) CheckUnique(o crud.Object) error {
+	keysList, err := encodeIndexKeys(o.SecondaryKeys())
+	if err != nil {
+		return err
+	}
+	return s.checkUnique(o.PrimaryKey(), keysList)
+}
+
+// checkUnique checks that the encoded secondary keys of the unique indexes point to no other object than primaryKey
+func (s Store) checkUnique(primaryKey []byte, encodedKeys [][]byte) error {
+	for _, encodedKey := range encodedKeys {
+		if !s.IsUnique(crud.IndexID(encodedKey[0])) {
+			continue
+		}
+		conflicting := s.uniqueValues.Get(encodedKey)
+		if conflicting == nil || bytes.Equal(conflicting, primaryKey) {
+			continue
+		}
+		sk, err := decodeIndexKey(encodedKey)
+		if err != nil {
+			return err
+		}
+		return &crud.UniqueViolationError{ID: sk.ID, Value: sk.Value, ConflictingKey: conflicting}
 	}
+	return nil
 }
 
 // Index creates, given a crud.Object, it's index value to primary key
 // pointers, and also the primary keys to indexes list
+// An object can have several values for the same index, the secondary keys it has twice are indexed once.
+// The object and its secondary keys are checked before any change, the changes made before a later error
+// are not undone: the caller discards them, as types.Store does by running its mutations on a cache.
 func (s Store) Index(o crud.Object) error {
-	primaryKey := o.PrimaryKey()                   // gets the object's primary key
-	secondaryKeys := o.SecondaryKeys()             // gets the object's secondary keys
-	keysList := make([][]byte, len(secondaryKeys)) // create the slice for computed index keys
-	// iterate over secondary keys
-	for i, secondaryKey := range secondaryKeys {
-		// make the secondary key point to this object
-		computedKey, err := s.mapKey(secondaryKey, primaryKey)
-		if err != nil {
+	primaryKey := o.PrimaryKey()
+	if s.primaryKeysIndexes.Has(primaryKey) {
+		return fmt.Errorf("%w: primary key %x is already indexed", crud.ErrAlreadyExists, primaryKey)
+	}
+	// encode the keys and check unique indexes before changing anything
+	keysList, err := encodeIndexKeys(o.SecondaryKeys())
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnique(primaryKey, keysList); err != nil {
+		return err
+	}
+	// make the secondary keys point to this object
+	for _, computedKey := range keysList {
+		if err := s.mapRawKey(computedKey, primaryKey); err != nil {
 			return err
 		}
-		// add the computed key obtained after registering it to the keys list
-		keysList[i] = computedKey
 	}
 	// save indexes list
-	err := s.saveIndexList(primaryKey, keysList)
+	return s.saveIndexList(primaryKey, keysList)
+}
+
+// Reindex updates the indexes of an already indexed object to its current secondary keys
+// only the index keys the object gained or lost are written, and its index list only if it changed,
+// so that updating an object without changing its secondary keys costs a single read.
+// The unique indexes are checked for the values the object gained only.
+// As with Index, the changes made before an error are not undone.
+func (s Store) Reindex(o crud.Object) error {
+	primaryKey := o.PrimaryKey()
+	previousKeys, err := s.getIndexList(primaryKey)
+	if err != nil {
+		return err
+	}
+	// encode the keys before changing anything
+	keysList, err := encodeIndexKeys(o.SecondaryKeys())
 	if err != nil {
-		// try to rollback what was done so far
-		err2 := s.unmapRawKeys(primaryKey, keysList)
-		// if it does not work panic, we got state corruption.
-		if err2 != nil {
-			panic(fmt.Errorf("state corruption unable to rollback index delete after error %s: %s", err, err2))
+		return err
+	}
+	// compute the keys removed and added
+	current := make(map[string]struct{}, len(keysList))
+	for _, key := range keysList {
+		current[string(key)] = struct{}{}
+	}
+	previous := make(map[string]struct{}, len(previousKeys))
+	var removed [][]byte
+	for _, key := range previousKeys {
+		previous[string(key)] = struct{}{}
+		if _, ok := current[string(key)]; !ok {
+			removed = append(removed, key)
 		}
 	}
-	return nil
+	var added [][]byte
+	for _, key := range keysList {
+		if _, ok := previous[string(key)]; !ok {
+			added = append(added, key)
+		}
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+	// the keys the object keeps already point to it, only the added ones can point to another object
+	if err := s.checkUnique(primaryKey, added); err != nil {
+		return err
+	}
+	if err := s.unmapRawKeys(primaryKey, removed); err != nil {
+		return err
+	}
+	for _, key := range added {
+		if err := s.mapRawKey(key, primaryKey); err != nil {
+			return err
+		}
+	}
+	return s.setIndexList(primaryKey, keysList)
 }
 
 // Delete retrieves the list of indexes which map to the given primary key
 // and gets rid of them, so in future queries using the indexes the object
 // is not retrieved anymore.
+// As with Index, the changes made before an error are not undone.
 func (s Store) Delete(primaryKey []byte) error {
 	secondaryKeys, err := s.getIndexList(primaryKey)
 	if err != nil {
@@ -104,14 +220,40 @@ func (s Store) Delete(primaryKey []byte) error {
 	}
 	err = s.unmapRawKeys(primaryKey, secondaryKeys)
 	if err != nil {
-		// state corruption, as we might have deleted a subset of keys
-		// but not all of them... sad but true
-		panic(err)
+		return err
 	}
 	// clear index list
-	err = s.deleteIndexList(primaryKey)
-	if err != nil {
-		return err
+	return s.deleteIndexList(primaryKey)
+}
+
+// BuildRanks builds the ranks of the primary keys of each index key, if they are maintained,
+// in a single pass over the indexes: the ranks must be empty, it is used when they are rebuilt
+func (s Store) BuildRanks() error {
+	if s.ranks == nil {
+		return nil
+	}
+	iter := s.indexes.Iterator(nil, nil)
+	defer iter.Close()
+	// the primary keys of an index key are contiguous and in ascending order
+	var encodedKey []byte
+	var builder *ranks.Builder
+	for ; iter.Valid(); iter.Next() {
+		key, primaryKey, err := splitIndexKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if builder == nil || !bytes.Equal(key, encodedKey) {
+			if builder != nil {
+				builder.Close()
+			}
+			encodedKey, builder = key, s.ranks.Set(key).Builder()
+		}
+		if err := builder.Add(primaryKey); err != nil {
+			return err
+		}
+	}
+	if builder != nil {
+		builder.Close()
 	}
 	return nil
 }
@@ -170,18 +312,42 @@ func (s Store) getPrimaryKeysFromIndex(sk crud.SecondaryKey, start uint64, end u
 	return nil
 }
 
-// mapKey maps the given primary key to the secondary key, so when iterating a prefixed store
-// created from a secondary key we will find the provided primary key.
-func (s Store) mapKey(secondaryKey crud.SecondaryKey, primaryKey []byte) (computedKey []byte, err error) {
-	store, computedKey, err := s.kvStore(secondaryKey)
-	if err != nil {
-		return nil, err
+// encodeIndexKeys encodes the secondary keys of an object, the secondary keys it has twice are encoded once
+func encodeIndexKeys(secondaryKeys []crud.SecondaryKey) ([][]byte, error) {
+	keysList := make([][]byte, 0, len(secondaryKeys))
+	encoded := make(map[string]struct{}, len(secondaryKeys))
+	for _, secondaryKey := range secondaryKeys {
+		computedKey, err := encodeIndexKey(secondaryKey)
+		if err != nil {
+			return nil, err
+		}
+		// duplicated secondary keys collapse
+		if _, ok := encoded[string(computedKey)]; ok {
+			continue
+		}
+		encoded[string(computedKey)] = struct{}{}
+		keysList = append(keysList, computedKey)
 	}
+	return keysList, nil
+}
+
+// mapRawKey maps the given primary key to the encoded secondary key, so when iterating a prefixed store
+// created from the secondary key we will find the provided primary key.
+func (s Store) mapRawKey(encodedKey []byte, primaryKey []byte) error {
+	store := s.kvStoreRaw(encodedKey)
 	if store.Has(primaryKey) {
-		return nil, fmt.Errorf("%w: primary key %x in index %s", crud.ErrAlreadyExists, primaryKey, secondaryKey)
+		return fmt.Errorf("%w: primary key %x in index key prefixed store %x", crud.ErrAlreadyExists, primaryKey, encodedKey)
 	}
 	store.Set(primaryKey, []byte{})
-	return computedKey, nil
+	if s.IsUnique(crud.IndexID(encodedKey[0])) {
+		s.uniqueValues.Set(encodedKey, primaryKey)
+	}
+	s.metadata.IncreaseIndexCount(encodedKey)
+	if s.ranks != nil {
+		// encoded index keys are never the prefix of one another so they can identify the sets
+		return s.ranks.Set(encodedKey).Insert(primaryKey)
+	}
+	return nil
 }
 
 func (s Store) unmapRawKeys(primaryKey []byte, encodedKeys [][]byte) error {
@@ -191,6 +357,17 @@ func (s Store) unmapRawKeys(primaryKey []byte, encodedKeys [][]byte) error {
 			return fmt.Errorf("%w: key %x was not found in index key prefixed store %x", crud.ErrNotFound, primaryKey, encKey)
 		}
 		store.Delete(primaryKey)
+		if s.IsUnique(crud.IndexID(encKey[0])) {
+			s.uniqueValues.Delete(encKey)
+		}
+		if err := s.metadata.DecreaseIndexCount(encKey); err != nil {
+			return err
+		}
+		if s.ranks != nil {
+			if err := s.ranks.Set(encKey).Remove(primaryKey); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -221,6 +398,14 @@ func (s Store) kvStoreRaw(encodedKey []byte) sdk.KVStore {
 // it's fairly easy to understand which secondary keys point to it
 // and so update or delete them
 func (s Store) saveIndexList(primaryKey []byte, encodedKeys [][]byte) error {
+	if s.primaryKeysIndexes.Has(primaryKey) {
+		return fmt.Errorf("%w: key %x already exists in index list store", crud.ErrAlreadyExists, primaryKey)
+	}
+	return s.setIndexList(primaryKey, encodedKeys)
+}
+
+// setIndexList stores the encoded secondary keys of the primary key, replacing the previous ones
+func (s Store) setIndexList(primaryKey []byte, encodedKeys [][]byte) error {
 	// sort keys deterministically
 	util.SortByteSlice(encodedKeys)
 	// marshal index list
@@ -229,9 +414,6 @@ func (s Store) saveIndexList(primaryKey []byte, encodedKeys [][]byte) error {
 		return err
 	}
 	// save data to store
-	if s.primaryKeysIndexes.Has(primaryKey) {
-		return fmt.Errorf("%w: key %x already exists in index list store", crud.ErrAlreadyExists, primaryKey)
-	}
 	s.primaryKeysIndexes.Set(primaryKey, b)
 	return nil
 }
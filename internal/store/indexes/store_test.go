@@ -2,13 +2,22 @@ package indexes
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/rand"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/store/prefix"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/metadata"
 	"github.com/iov-one/cosmos-sdk-crud/internal/test"
 )
 
@@ -114,6 +123,182 @@ func TestStore(t *testing.T) {
 	})
 }
 
+func TestStore_unique(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	db := ctx.KVStore(key)
+	store := NewStore(cdc, prefix.NewStore(db, []byte{0x0}), metadata.NewStore(prefix.NewStore(db, []byte{0x1})), nil, []crud.IndexID{test.IndexID_B})
+	test.CheckNoError(t, store.Index(test.NewCustomObject("pk1", "shared", "unique1")))
+
+	t.Run("unique value", func(t *testing.T) {
+		// the non unique index can have the same value
+		test.CheckNoError(t, store.Index(test.NewCustomObject("pk2", "shared", "unique2")))
+		test.CheckNoError(t, store.CheckUnique(test.NewCustomObject("pk2", "other", "unique2")))
+	})
+	t.Run("violation", func(t *testing.T) {
+		obj := test.NewCustomObject("pk3", "shared", "unique1")
+		err := store.Index(obj)
+		if !errors.Is(err, crud.ErrUniqueViolation) || !errors.Is(err, crud.ErrAlreadyExists) {
+			t.Fatal("unexpected error", err)
+		}
+		if !strings.Contains(err.Error(), hex.EncodeToString([]byte("pk1"))) {
+			t.Fatal("the error should name the conflicting primary key", err)
+		}
+		// nothing was indexed
+		if _, err := store.getIndexList(obj.PrimaryKey()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+		pks, err := store.Filter([]crud.SecondaryKey{obj.FirstSecondaryKey()}, 0, 0)
+		test.CheckNoError(t, err)
+		if len(pks) != 2 {
+			t.Fatal("unexpected number of primary keys", len(pks))
+		}
+	})
+	t.Run("duplicated values", func(t *testing.T) {
+		// the same value given twice is indexed once
+		obj := test.NewCustomObject("pk4", "duplicated", "duplicated")
+		obj.TestSecondaryKeyB = nil
+		test.CheckNoError(t, store.Index(keysObject{obj, []crud.SecondaryKey{obj.FirstSecondaryKey(), obj.FirstSecondaryKey()}}))
+		pks, err := store.Filter([]crud.SecondaryKey{obj.FirstSecondaryKey()}, 0, 0)
+		test.CheckNoError(t, err)
+		if len(pks) != 1 {
+			t.Fatal("unexpected number of primary keys", len(pks))
+		}
+		if count := store.metadata.IndexCount(mustEncode(t, obj.FirstSecondaryKey())); count != 1 {
+			t.Fatal("unexpected index count", count)
+		}
+		test.CheckNoError(t, store.Delete(obj.PrimaryKey()))
+	})
+	t.Run("rollback", func(t *testing.T) {
+		// the second key cannot be mapped as its value is too long
+		obj := test.NewCustomObject("pk5", "rollback", "rollback")
+		tooLong := crud.SecondaryKey{ID: obj.FirstSecondaryKey().ID, Value: make([]byte, maxKeyLength+1)}
+		if err := store.Index(keysObject{obj, []crud.SecondaryKey{obj.FirstSecondaryKey(), tooLong}}); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+		pks, err := store.Filter([]crud.SecondaryKey{obj.FirstSecondaryKey()}, 0, 0)
+		test.CheckNoError(t, err)
+		if len(pks) != 0 {
+			t.Fatal("the keys mapped before the error should have been removed")
+		}
+		if count := store.metadata.IndexCount(mustEncode(t, obj.FirstSecondaryKey())); count != 0 {
+			t.Fatal("unexpected index count", count)
+		}
+	})
+}
+
+func TestStore_Reindex(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	db := ctx.KVStore(key)
+	store := NewStore(cdc, prefix.NewStore(db, []byte{0x0}), metadata.NewStore(prefix.NewStore(db, []byte{0x1})), nil, []crud.IndexID{test.IndexID_B})
+	test.CheckNoError(t, store.Index(test.NewCustomObject("pk1", "a1", "b1")))
+	test.CheckNoError(t, store.Index(test.NewCustomObject("pk2", "a1", "b2")))
+
+	// pks returns the primary keys the secondary key points to
+	pks := func(t *testing.T, id crud.IndexID, value string) [][]byte {
+		pks, err := store.Filter([]crud.SecondaryKey{{ID: id, Value: []byte(value)}}, 0, 0)
+		test.CheckNoError(t, err)
+		return pks
+	}
+	// list returns the index list of the primary key
+	list := func(t *testing.T, pk string) [][]byte {
+		list, err := store.getIndexList([]byte(pk))
+		test.CheckNoError(t, err)
+		return list
+	}
+
+	t.Run("changed keys", func(t *testing.T) {
+		obj := test.NewCustomObject("pk1", "a2", "b1")
+		test.CheckNoError(t, store.Reindex(obj))
+		if len(pks(t, test.IndexID_A, "a1")) != 1 || len(pks(t, test.IndexID_A, "a2")) != 1 || len(pks(t, test.IndexID_B, "b1")) != 1 {
+			t.Fatal("unexpected index keys")
+		}
+		if count := store.metadata.IndexCount(mustEncode(t, crud.SecondaryKey{ID: test.IndexID_A, Value: []byte("a1")})); count != 1 {
+			t.Fatal("unexpected index count", count)
+		}
+		expected := [][]byte{mustEncode(t, obj.FirstSecondaryKey()), mustEncode(t, obj.SecondSecondaryKey())}
+		if actual := list(t, "pk1"); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected index list (expected : %x, actual : %x)", expected, actual)
+		}
+	})
+	t.Run("unchanged keys", func(t *testing.T) {
+		// the object is indexed with the same keys, given in another order and duplicated
+		obj := test.NewCustomObject("pk1", "a2", "b1")
+		expected := list(t, "pk1")
+		before := ctx.GasMeter().GasConsumed()
+		test.CheckNoError(t, store.Reindex(keysObject{obj, []crud.SecondaryKey{obj.SecondSecondaryKey(), obj.FirstSecondaryKey(), obj.SecondSecondaryKey()}}))
+		// a single write costs more than the reads
+		if gas := ctx.GasMeter().GasConsumed() - before; gas >= storetypes.KVGasConfig().WriteCostFlat {
+			t.Fatal("nothing should have been written, gas consumed", gas)
+		}
+		if actual := list(t, "pk1"); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected index list (expected : %x, actual : %x)", expected, actual)
+		}
+	})
+	t.Run("not found", func(t *testing.T) {
+		if err := store.Reindex(test.NewCustomObject("pk3", "a1", "b3")); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(pks(t, test.IndexID_B, "b3")) != 0 {
+			t.Fatal("the object should not have been indexed")
+		}
+	})
+	t.Run("unique violation", func(t *testing.T) {
+		if err := store.Reindex(test.NewCustomObject("pk2", "a3", "b1")); !errors.Is(err, crud.ErrUniqueViolation) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(pks(t, test.IndexID_A, "a3")) != 0 || len(pks(t, test.IndexID_B, "b2")) != 1 {
+			t.Fatal("the indexes should not have changed")
+		}
+	})
+	t.Run("kept unique value", func(t *testing.T) {
+		// the value was shared before the index was declared unique, the objects keeping it are still updated
+		shared := NewStore(cdc, prefix.NewStore(db, []byte{0x2}), metadata.NewStore(prefix.NewStore(db, []byte{0x3})), nil, nil)
+		test.CheckNoError(t, shared.Index(test.NewCustomObject("pk1", "a1", "shared")))
+		test.CheckNoError(t, shared.Index(test.NewCustomObject("pk2", "a1", "shared")))
+		unique := shared
+		unique.unique = map[crud.IndexID]struct{}{test.IndexID_B: {}}
+		test.CheckNoError(t, unique.Reindex(test.NewCustomObject("pk1", "a2", "shared")))
+		if err := unique.Reindex(test.NewCustomObject("pk1", "a2", "b2")); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if err := unique.Reindex(test.NewCustomObject("pk2", "a1", "b2")); !errors.Is(err, crud.ErrUniqueViolation) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("bad argument", func(t *testing.T) {
+		obj := test.NewCustomObject("pk2", "a3", "b2")
+		tooLong := crud.SecondaryKey{ID: test.IndexID_A, Value: make([]byte, maxKeyLength+1)}
+		if err := store.Reindex(keysObject{obj, []crud.SecondaryKey{obj.FirstSecondaryKey(), tooLong}}); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(pks(t, test.IndexID_A, "a3")) != 0 || len(pks(t, test.IndexID_B, "b2")) != 1 {
+			t.Fatal("the indexes should not have changed")
+		}
+	})
+}
+
+// keysObject is an object with the given secondary keys
+type keysObject struct {
+	test.Object
+	keys []crud.SecondaryKey
+}
+
+func (o keysObject) SecondaryKeys() []crud.SecondaryKey {
+	return o.keys
+}
+
+func mustEncode(t *testing.T, sk crud.SecondaryKey) []byte {
+	key, err := encodeIndexKey(sk)
+	test.CheckNoError(t, err)
+	return key
+}
+
 func BenchmarkStore_Index(b *testing.B) {
 	s := createTestStore()
 
@@ -133,6 +318,56 @@ func BenchmarkStore_Index(b *testing.B) {
 	}
 }
 
+// BenchmarkStore_UpdateGas compares the gas consumed by updating the indexes of an object with several indexes
+// by deleting and indexing it again, as updates used to do, and by reindexing it
+func BenchmarkStore_UpdateGas(b *testing.B) {
+	const indexCount = 8
+	// newObject returns the object pk1 whose first changed index values are suffixed by version
+	newObject := func(changed int, version int) keysObject {
+		keys := make([]crud.SecondaryKey, indexCount)
+		for i := range keys {
+			value := "value" + strconv.Itoa(i)
+			if i < changed {
+				value += "-" + strconv.Itoa(version)
+			}
+			keys[i] = crud.SecondaryKey{ID: crud.IndexID(i), Value: []byte(value)}
+		}
+		return keysObject{test.NewCustomObject("pk1", "", ""), keys}
+	}
+	updates := map[string]func(s Store, o crud.Object) error{
+		"delete and index": func(s Store, o crud.Object) error {
+			if err := s.Delete(o.PrimaryKey()); err != nil {
+				return err
+			}
+			return s.Index(o)
+		},
+		"reindex": Store.Reindex,
+	}
+	for _, changed := range []int{0, 1, indexCount} {
+		for name, update := range updates {
+			b.Run(fmt.Sprintf("changed=%d/%s", changed, name), func(b *testing.B) {
+				ctx, key, cdc, err := test.New()
+				if err != nil {
+					b.Fatal(err)
+				}
+				meter := sdk.NewInfiniteGasMeter()
+				s := newTestStore(cdc, ctx.WithGasMeter(meter).KVStore(key))
+				if err := s.Index(newObject(changed, 0)); err != nil {
+					b.Fatal(err)
+				}
+				consumed := meter.GasConsumed()
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					if err := update(s, newObject(changed, n+1)); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(meter.GasConsumed()-consumed)/float64(b.N), "gas/op")
+			})
+		}
+	}
+}
+
 // Helper functions for testing
 func checkIndex(t *testing.T, store *Store, expected *test.Object) {
 	var pks, err = store.QueryAll(expected.SecondaryKeys()[0])
@@ -149,6 +384,10 @@ func createTestStore() Store {
 	if err != nil {
 		panic("failed to create store:" + err.Error())
 	}
-	testKVStore := ctx.KVStore(key)
-	return NewStore(cdc, testKVStore)
+	return newTestStore(cdc, ctx.KVStore(key))
+}
+
+// newTestStore builds an index store and its metadata store on the given kv store
+func newTestStore(cdc codec.Codec, db sdk.KVStore) Store {
+	return NewStore(cdc, prefix.NewStore(db, []byte{0x0}), metadata.NewStore(prefix.NewStore(db, []byte{0x1})), nil, nil)
 }
@@ -0,0 +1,100 @@
+package indexes
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
+)
+
+// ValuesIterator iterates over the distinct values of an index along with the number of objects having each of them
+type ValuesIterator struct {
+	iter sdk.Iterator
+	rng  *util.Range
+
+	valid    bool
+	value    []byte
+	count    uint64
+	position []byte
+	// err is the error which stopped the iteration
+	err error
+}
+
+// Values returns an iterator over the distinct values of the index id coming from the position from included,
+// in the interval [start, end[ relative to it and in descending order if descending is true, in ascending order otherwise.
+// The values are read from the index counters, so the primary keys pointed by them are not visited.
+func (s Store) Values(id crud.IndexID, from []byte, start, end uint64, descending bool) (*ValuesIterator, error) {
+	rng, err := util.NewRange(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", crud.ErrBadArgument, err)
+	}
+	if from != nil {
+		// the position must be an encoded key of the index
+		if _, err := encodedKeyLength(from); err != nil || from[0] != byte(id) {
+			return nil, fmt.Errorf("%w: position %x is not in index %d", crud.ErrBadArgument, from, id)
+		}
+	}
+	it := &ValuesIterator{
+		iter: s.metadata.IndexCountIterator([]byte{byte(id)}, from, descending),
+		rng:  rng,
+	}
+	it.Next()
+	return it, nil
+}
+
+// Next moves to the next value in the range
+// the iteration stops if a counter key cannot be decoded, which is state corruption
+func (it *ValuesIterator) Next() {
+	if it.err != nil {
+		return
+	}
+	for {
+		noMoreValues := !it.iter.Valid()
+		inRange, stopIter := it.rng.CheckAndMoveForward()
+		if noMoreValues || stopIter {
+			_ = it.iter.Close()
+			it.valid, it.value, it.count, it.position = false, nil, 0, nil
+			return
+		}
+		encodedKey, count := it.iter.Key(), sdk.BigEndianToUint64(it.iter.Value())
+		it.iter.Next()
+		if !inRange {
+			continue
+		}
+		sk, err := decodeIndexKey(encodedKey)
+		if err != nil {
+			_ = it.iter.Close()
+			it.valid, it.value, it.count, it.position, it.err = false, nil, 0, nil, err
+			return
+		}
+		it.valid, it.value, it.count, it.position = true, sk.Value, count, encodedKey
+		return
+	}
+}
+
+// Valid tells if the iterator is on a value
+func (it *ValuesIterator) Valid() bool {
+	return it.valid
+}
+
+// Value returns the current index value
+func (it *ValuesIterator) Value() []byte {
+	return it.value
+}
+
+// Count returns the number of objects having the current index value
+func (it *ValuesIterator) Count() uint64 {
+	return it.count
+}
+
+// Error returns the error which stopped the iteration before its end, if any
+func (it *ValuesIterator) Error() error {
+	return it.err
+}
+
+// Position returns the position of the current value, an iteration starting from it yields the current value first
+func (it *ValuesIterator) Position() []byte {
+	return it.position
+}
@@ -1,24 +1,43 @@
 package iterator
 
 type KeyIterator struct {
-	isValid bool
-	value   []byte
+	isValid  bool
+	value    []byte
+	position []byte
+	err      error
 
-	nextValue func() ([]byte, bool)
+	nextValue func() (value, position []byte, valid bool, err error)
 }
 
+// NewKeyIterator returns an iterator whose keys are their own position
 func NewKeyIterator(next func() ([]byte, bool)) *KeyIterator {
+	return NewPositionedKeyIterator(func() ([]byte, []byte, bool, error) {
+		value, valid := next()
+		return value, value, valid, nil
+	})
+}
+
+// NewPositionedKeyIterator returns an iterator whose keys are found with their position in the iteration
+// the iteration stops at the first error returned by next, which Error returns
+func NewPositionedKeyIterator(next func() (value, position []byte, valid bool, err error)) *KeyIterator {
+	it := &KeyIterator{nextValue: next}
 	// Move to first element
-	value, valid := next()
-	return &KeyIterator{
-		isValid:   valid,
-		value:     value,
-		nextValue: next,
-	}
+	it.Next()
+	return it
 }
 
 func (it *KeyIterator) Next() {
-	it.value, it.isValid = it.nextValue()
+	if it.err != nil {
+		return
+	}
+	it.value, it.position, it.isValid, it.err = it.nextValue()
+	if it.err != nil {
+		it.value, it.position, it.isValid = nil, nil, false
+	}
+}
+
+func (it *KeyIterator) Position() []byte {
+	return it.position
 }
 
 func (it *KeyIterator) Valid() bool {
@@ -29,6 +48,10 @@ func (it *KeyIterator) Get() []byte {
 	return it.value
 }
 
+func (it *KeyIterator) Error() error {
+	return it.err
+}
+
 func (it *KeyIterator) Collect() [][]byte {
 	data := make([][]byte, 0)
 	for ; it.Valid(); it.Next() {
@@ -42,4 +65,6 @@ type NilIterator struct{}
 func (it NilIterator) Next()             {}
 func (it NilIterator) Valid() bool       { return false }
 func (it NilIterator) Get() []byte       { return nil }
+func (it NilIterator) Position() []byte  { return nil }
+func (it NilIterator) Error() error      { return nil }
 func (it NilIterator) Collect() [][]byte { return make([][]byte, 0) }
@@ -1,18 +1,109 @@
 package metadata
 
 import (
-	"github.com/cosmos/cosmos-sdk/codec"
+	"fmt"
+
+	"github.com/cosmos/cosmos-sdk/store/prefix"
 	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
+// objectCountKey is the key at which the number of objects in the store is saved
+const objectCountKey = 0x0
+
+// indexCountsPrefix is the prefix used to save the number of objects per index value
+const indexCountsPrefix = 0x1
+
+// Store defines the metadata store, it maintains counters about the objects
+// so that they can be counted without iterating over them
 type Store struct {
-	cdc codec.Codec
-	db  sdk.KVStore
+	db sdk.KVStore
+	// indexCounts maps encoded index keys to the number of objects they point to
+	indexCounts sdk.KVStore
 }
 
-func NewStore(cdc codec.Codec, db sdk.KVStore) Store {
+func NewStore(db sdk.KVStore) Store {
 	return Store{
-		cdc: cdc,
-		db:  db,
+		db:          db,
+		indexCounts: prefix.NewStore(db, []byte{indexCountsPrefix}),
+	}
+}
+
+// ObjectCount returns the number of objects in the store
+func (s Store) ObjectCount() uint64 {
+	return getCounter(s.db, []byte{objectCountKey})
+}
+
+// IncreaseObjectCount increases by one the number of objects in the store
+func (s Store) IncreaseObjectCount() {
+	increaseCounter(s.db, []byte{objectCountKey})
+}
+
+// DecreaseObjectCount decreases by one the number of objects in the store
+func (s Store) DecreaseObjectCount() error {
+	return decreaseCounter(s.db, []byte{objectCountKey})
+}
+
+// IndexCount returns the number of objects pointed by the given encoded index key
+func (s Store) IndexCount(encodedKey []byte) uint64 {
+	return getCounter(s.indexCounts, encodedKey)
+}
+
+// IncreaseIndexCount increases by one the number of objects pointed by the given encoded index key
+func (s Store) IncreaseIndexCount(encodedKey []byte) {
+	increaseCounter(s.indexCounts, encodedKey)
+}
+
+// DecreaseIndexCount decreases by one the number of objects pointed by the given encoded index key
+func (s Store) DecreaseIndexCount(encodedKey []byte) error {
+	return decreaseCounter(s.indexCounts, encodedKey)
+}
+
+// IndexCountIterator returns an iterator over the counters of the encoded index keys starting with the given prefix,
+// from the encoded key from included, if not nil, in descending order if descending is true.
+// The keys of the iterator are the encoded index keys and its values the big endian encoded counters.
+func (s Store) IndexCountIterator(keyPrefix, from []byte, descending bool) sdk.Iterator {
+	start, end := keyPrefix, sdk.PrefixEndBytes(keyPrefix)
+	if descending {
+		if from != nil {
+			_, end = util.IteratorBounds(from, descending)
+		}
+		return s.indexCounts.ReverseIterator(start, end)
+	}
+	if from != nil {
+		start = from
+	}
+	return s.indexCounts.Iterator(start, end)
+}
+
+// getCounter returns the counter saved at the given key, 0 if there is none
+func getCounter(db sdk.KVStore, key []byte) uint64 {
+	b := db.Get(key)
+	if b == nil {
+		return 0
+	}
+	return sdk.BigEndianToUint64(b)
+}
+
+func increaseCounter(db sdk.KVStore, key []byte) {
+	db.Set(key, sdk.Uint64ToBigEndian(getCounter(db, key)+1))
+}
+
+// decreaseCounter decreases the counter saved at the given key, the counter is deleted when reaching 0
+// so that no key is left for index values which are not used anymore.
+// A missing counter means the store was written by a version which did not maintain the counters,
+// whose counters are built by types.Store.RebuildIndexes.
+func decreaseCounter(db sdk.KVStore, key []byte) error {
+	count := getCounter(db, key)
+	switch count {
+	case 0:
+		return fmt.Errorf("%w: counter %x is already 0, the counters of a store written by a previous version must be built by RebuildIndexes", crud.ErrInternal, key)
+	case 1:
+		db.Delete(key)
+	default:
+		db.Set(key, sdk.Uint64ToBigEndian(count-1))
 	}
+	return nil
 }
@@ -0,0 +1,54 @@
+package metadata
+
+import (
+	"errors"
+	"testing"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/test"
+)
+
+func TestStore(t *testing.T) {
+	ctx, key, _, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	store := NewStore(ctx.KVStore(key))
+
+	t.Run("object count", func(t *testing.T) {
+		if count := store.ObjectCount(); count != 0 {
+			t.Fatal("Unexpected count for empty store", count)
+		}
+		store.IncreaseObjectCount()
+		store.IncreaseObjectCount()
+		test.CheckNoError(t, store.DecreaseObjectCount())
+		if count := store.ObjectCount(); count != 1 {
+			t.Fatal("Unexpected count (expecting 1, actual", count, ")")
+		}
+	})
+
+	t.Run("index counts", func(t *testing.T) {
+		keyA, keyB := []byte{0x0, 'a', 0x0, 0x1}, []byte{0x0, 'b', 0x0, 0x1}
+		store.IncreaseIndexCount(keyA)
+		store.IncreaseIndexCount(keyA)
+		store.IncreaseIndexCount(keyB)
+		test.CheckNoError(t, store.DecreaseIndexCount(keyB))
+		if count := store.IndexCount(keyA); count != 2 {
+			t.Fatal("Unexpected count (expecting 2, actual", count, ")")
+		}
+		if count := store.IndexCount(keyB); count != 0 {
+			t.Fatal("Unexpected count (expecting 0, actual", count, ")")
+		}
+		// counters reaching 0 are removed
+		if store.indexCounts.Has(keyB) {
+			t.Fatal("Counter at 0 still stored")
+		}
+	})
+
+	t.Run("decrease below zero", func(t *testing.T) {
+		err := store.DecreaseIndexCount([]byte{0x1, 'c', 0x0, 0x1})
+		if !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+	})
+}
@@ -8,22 +8,31 @@ import (
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/iterator"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/ranks"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
 // NewStore is Store's constructor
-func NewStore(cdc codec.Codec, db sdk.KVStore) Store {
-	return Store{
+// the ranks of the primary keys are maintained in the given ranks store, if not nil
+func NewStore(cdc codec.Codec, db sdk.KVStore, ranksStore *ranks.Store) Store {
+	s := Store{
 		db:  db,
 		cdc: cdc,
 	}
+	if ranksStore != nil {
+		set := ranksStore.Set(nil)
+		s.ranks = &set
+	}
+	return s
 }
 
 // Store builds an object store
 type Store struct {
 	db  sdk.KVStore
 	cdc codec.Codec
+	// ranks allows to find the primary key at a given rank, nil if the ranks are not maintained
+	ranks *ranks.Set
 }
 
 // Create creates the object in the store
@@ -35,7 +44,33 @@ func (s Store) Create(o crud.Object) error {
 		return fmt.Errorf("%w: primary key %x", crud.ErrAlreadyExists, pk)
 	}
 	err := s.set(pk, o)
-	return err
+	if err != nil {
+		return err
+	}
+	if s.ranks != nil {
+		return s.ranks.Insert(pk)
+	}
+	return nil
+}
+
+// Save saves the object, creating it if it does not exist yet
+// created tells if it was created, the existence of the object being checked with a single read
+func (s Store) Save(o crud.Object) (created bool, err error) {
+	pk := o.PrimaryKey()
+	created = !s.db.Has(pk)
+	err = s.set(pk, o)
+	if err != nil {
+		return false, err
+	}
+	if created && s.ranks != nil {
+		return false, s.ranks.Insert(pk)
+	}
+	return created, nil
+}
+
+// Has checks if an object with the given primary key exists
+func (s Store) Has(pk []byte) bool {
+	return s.db.Has(pk)
 }
 
 // Store retrieves the object given its primary key
@@ -78,22 +113,67 @@ func (s Store) Delete(primaryKey []byte) error {
 		return fmt.Errorf("%w: primary key %x", crud.ErrNotFound, primaryKey)
 	}
 	s.db.Delete(primaryKey)
+	if s.ranks != nil {
+		return s.ranks.Remove(primaryKey)
+	}
+	return nil
+}
+
+// BuildRanks builds the ranks of the primary keys of the objects saved, if they are maintained,
+// in a single pass over the primary keys: the ranks must be empty, it is used when they are rebuilt
+func (s Store) BuildRanks() error {
+	if s.ranks == nil {
+		return nil
+	}
+	builder := s.ranks.Builder()
+	it := s.db.Iterator(nil, nil)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		if err := builder.Add(it.Key()); err != nil {
+			return err
+		}
+	}
+	builder.Close()
 	return nil
 }
 
 // GetAllKeysWithIterator returns an iterator yielding the primary key of all the objects present in the store
-// in the interval [start, end[ and in ascending order.
-func (s Store) GetAllKeysWithIterator(start uint64, end uint64) (types.Iterator, error) {
+// in the interval [start, end[ and in ascending order, or in descending order if descending is true.
+func (s Store) GetAllKeysWithIterator(start uint64, end uint64, descending bool) (types.Iterator, error) {
+	return s.GetKeysFrom(nil, start, end, descending)
+}
+
+// GetKeysFrom is GetAllKeysWithIterator for the primary keys coming from the primary key from included,
+// in the iteration order, the interval [start, end[ being relative to it.
+func (s Store) GetKeysFrom(from []byte, start uint64, end uint64, descending bool) (types.Iterator, error) {
 	// We could use append but it has to reallocate each time its capacity is reached
 	// Tracking the number of objects on the store is more efficient
 
-	// The start and end arguments of Iterator() are not indexes but byte array boundaries
-	it := s.db.Iterator(nil, nil)
-
 	rng, err := util.NewRange(start, end)
 	if err != nil {
 		return iterator.NilIterator{}, err
 	}
+	// when the ranks are maintained, the iteration starts at the first object of the range
+	if s.ranks != nil && from == nil && start != 0 {
+		pk, ok, err := s.ranks.Select(start, descending)
+		if err != nil {
+			return iterator.NilIterator{}, err
+		}
+		if !ok {
+			return iterator.NilIterator{}, nil
+		}
+		from = pk
+		rng.Skip(start)
+	}
+
+	// The start and end arguments of Iterator() are not indexes but byte array boundaries
+	var it sdk.Iterator
+	lower, upper := util.IteratorBounds(from, descending)
+	if descending {
+		it = s.db.ReverseIterator(lower, upper)
+	} else {
+		it = s.db.Iterator(lower, upper)
+	}
 
 	resultIterator := iterator.NewKeyIterator(func() ([]byte, bool) {
 		for {
@@ -118,11 +198,12 @@ func (s Store) GetAllKeysWithIterator(start uint64, end uint64) (types.Iterator,
 // GetAllKeys returns a slice containing the primary key of all the objects present in the store
 // in the interval [start, end[ and in ascending order.
 func (s Store) GetAllKeys(start, end uint64) ([][]byte, error) {
-	it, err := s.GetAllKeysWithIterator(start, end)
+	it, err := s.GetAllKeysWithIterator(start, end, false)
 	if err != nil {
 		return nil, err
 	}
-	return it.Collect(), err
+	keys := it.Collect()
+	return keys, it.Error()
 }
 
 // set takes care of doing object marshalling
@@ -17,7 +17,7 @@ func TestStore(t *testing.T) {
 	if err != nil {
 		t.Fatal("failed precondition", err)
 	}
-	store := NewStore(cdc, db)
+	store := NewStore(cdc, db, nil)
 	t.Run("create", func(t *testing.T) {
 		obj := test.NewRandomObject()
 		// test creation
@@ -139,6 +139,20 @@ func TestStore(t *testing.T) {
 		checkKeys(t, actual, objs)
 	})
 
+	t.Run("get all key descending", func(t *testing.T) {
+		store, objs := createStoreWithRandomObjects(cdc, db, t, 10, "allkeydesc")
+
+		it, err := store.GetAllKeysWithIterator(2, 5, true)
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		var actual [][]byte
+		for ; it.Valid(); it.Next() {
+			actual = append(actual, it.Get())
+		}
+		checkKeys(t, actual, []crud.Object{objs[7], objs[6], objs[5]})
+	})
+
 	t.Run("get key range", func(t *testing.T) {
 		store, objs := createStoreWithRandomObjects(cdc, db, t, 10, "keyrange")
 
@@ -177,7 +191,7 @@ func checkKeys(t *testing.T, actual [][]byte, objects []crud.Object) {
 }
 
 func createStoreWithRandomObjects(cdc codec.Codec, db sdk.KVStore, t *testing.T, n int, uniqueID string) (Store, []crud.Object) {
-	store := NewStore(cdc, prefix.NewStore(db, []byte(uniqueID)))
+	store := NewStore(cdc, prefix.NewStore(db, []byte(uniqueID)), nil)
 	addToStore := func(obj crud.Object) error {
 		return store.Create(obj)
 	}
@@ -0,0 +1,351 @@
+package ranks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+
+	"github.com/cosmos/cosmos-sdk/store/prefix"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+)
+
+// levelBits is the number of bits of the hash of a key which must be zero for the key to go one level up,
+// so that the buckets of a level hold on average 2^levelBits buckets of the level below
+const levelBits = 4
+
+// maxLevel is the number of levels of buckets above the keys, on average the buckets of the top level
+// hold 2^(levelBits*maxLevel) keys
+const maxLevel = 6
+
+// headBoundary is the encoded boundary of the first bucket of each level, which starts before any key
+const headBoundary = 0x0
+
+// keyBoundaryPrefix is the prefix of the encoded boundaries of the buckets starting at a key
+const keyBoundaryPrefix = 0x1
+
+// countLength is the length of the encoded number of keys of a bucket
+const countLength = 8
+
+// Store defines the ranks store, it keeps for sets of keys saved in other stores the number of keys
+// in buckets of keys, so that the key at a given rank in a set is found in logarithmic time
+// instead of iterating over all the keys before it
+type Store struct {
+	db sdk.KVStore
+}
+
+// NewStore is Store's constructor
+func NewStore(db sdk.KVStore) Store {
+	return Store{db: db}
+}
+
+// Set returns the ranks of the set of keys identified by id
+// the id of a set must not be a prefix of the id of another set of the same ranks store,
+// an empty id can be used if the ranks store holds a single set
+func (s Store) Set(id []byte) Set {
+	buckets := s.db
+	if len(id) != 0 {
+		buckets = prefix.NewStore(s.db, id)
+	}
+	return Set{buckets: buckets}
+}
+
+// Set maintains the ranks of a set of keys, it must be told about every key added to or removed from the set.
+// The keys are split in buckets of consecutive keys at several levels: a key whose hash starts with
+// level*levelBits zero bits starts a bucket of every level up to level, so that the bucket
+// boundaries do not depend on the order the keys were added in. A bucket of a level is split
+// in about 2^levelBits buckets of the level below, and the level 0 has a bucket per key.
+// The buckets of a level are linked in the order of their boundaries, each one being saved under the following key
+// <level><encoded boundary>
+// where the encoded boundary is <headBoundary> for the bucket starting before any key
+// and <keyBoundaryPrefix><key> for the buckets starting at a key, and holding as value
+// <number of keys of the bucket, 8 bytes big endian><encoded boundary of the next bucket of the level>
+// the number of keys being omitted at level 0, where it is 1 for the keys and 0 for the head.
+// Following the links from the top level down finds the bucket of a key, or of a rank, reading
+// about 2^levelBits buckets per level, so that the set is maintained without iterating over the store:
+// iterators opened while another iterator of the same cache is open deadlock once the cache was written.
+type Set struct {
+	// buckets stores the buckets of each level
+	buckets sdk.KVStore
+}
+
+// bucket is a bucket of a level
+type bucket struct {
+	// boundary is the encoded boundary the bucket starts at
+	boundary []byte
+	// count is the number of keys of the bucket
+	count uint64
+	// next is the encoded boundary of the next bucket of the level, nil for the last one
+	next []byte
+}
+
+// Insert adds the key to the ranks
+func (s Set) Insert(key []byte) error {
+	previous, err := s.previousBuckets(key)
+	if err != nil {
+		return err
+	}
+	boundary := encodeBoundary(key)
+	if bytes.Equal(previous[0].next, boundary) {
+		return fmt.Errorf("%w: key %x is already ranked", crud.ErrInternal, key)
+	}
+	keyLevel := level(key)
+	for l := 0; l <= maxLevel; l++ {
+		b := previous[l]
+		if l > keyLevel {
+			b.count++
+			s.save(l, b)
+			continue
+		}
+		// the key splits the bucket it belongs to, the keys after it move to its own bucket
+		size, err := s.bucketSize(l, boundary, b.next)
+		if err != nil {
+			return err
+		}
+		s.save(l, bucket{boundary: boundary, count: size, next: b.next})
+		b.count, b.next = b.count+1-size, boundary
+		s.save(l, b)
+	}
+	return nil
+}
+
+// Remove removes the key from the ranks
+func (s Set) Remove(key []byte) error {
+	previous, err := s.previousBuckets(key)
+	if err != nil {
+		return err
+	}
+	boundary := encodeBoundary(key)
+	keyLevel := level(key)
+	for l := 0; l <= maxLevel; l++ {
+		b := previous[l]
+		if l <= keyLevel {
+			// the bucket of the key is merged into the previous one
+			if !bytes.Equal(b.next, boundary) {
+				return fmt.Errorf("%w: key %x is not a boundary of level %d", crud.ErrInternal, key, l)
+			}
+			removed, err := s.load(l, boundary)
+			if err != nil {
+				return err
+			}
+			s.levelStore(l).Delete(boundary)
+			b.count, b.next = b.count+removed.count, removed.next
+		}
+		if b.count == 0 {
+			return fmt.Errorf("%w: bucket of key %x at level %d is empty", crud.ErrInternal, key, l)
+		}
+		b.count--
+		s.save(l, b)
+	}
+	return nil
+}
+
+// Select returns the key with the given rank, starting at 0, in the ascending order of the keys
+// or in descending order if descending is true
+// ok is false if the set does not have that many keys
+func (s Set) Select(rank uint64, descending bool) (key []byte, ok bool, err error) {
+	if descending {
+		count, err := s.Count()
+		if err != nil {
+			return nil, false, err
+		}
+		if rank >= count {
+			return nil, false, nil
+		}
+		rank = count - 1 - rank
+	}
+	// the bucket where the key is looked for, at first the whole set
+	boundary := []byte{headBoundary}
+	for l := maxLevel; l >= 0; l-- {
+		b, err := s.load(l, boundary)
+		if err != nil {
+			return nil, false, err
+		}
+		for rank >= b.count {
+			if b.next == nil {
+				return nil, false, nil
+			}
+			rank -= b.count
+			b, err = s.load(l, b.next)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		boundary = b.boundary
+	}
+	// the buckets of level 0 hold a single key
+	return decodeBoundary(boundary), true, nil
+}
+
+// Count returns the number of keys of the set
+func (s Set) Count() (uint64, error) {
+	var count uint64
+	for boundary := []byte{headBoundary}; boundary != nil; {
+		b, err := s.load(maxLevel, boundary)
+		if err != nil {
+			return 0, err
+		}
+		count += b.count
+		boundary = b.next
+	}
+	return count, nil
+}
+
+// previousBuckets returns, for each level, the last bucket starting before the key
+func (s Set) previousBuckets(key []byte) ([maxLevel + 1]bucket, error) {
+	var previous [maxLevel + 1]bucket
+	boundary := encodeBoundary(key)
+	start := []byte{headBoundary}
+	for l := maxLevel; l >= 0; l-- {
+		// the boundary of a bucket is the boundary of a bucket of every level below
+		b, err := s.load(l, start)
+		if err != nil {
+			return previous, err
+		}
+		for b.next != nil && bytes.Compare(b.next, boundary) < 0 {
+			b, err = s.load(l, b.next)
+			if err != nil {
+				return previous, err
+			}
+		}
+		previous[l], start = b, b.boundary
+	}
+	return previous, nil
+}
+
+// Builder builds the ranks of a set from its keys given in ascending order, writing each bucket once
+// instead of looking for the buckets of every key as Insert does
+type Builder struct {
+	set Set
+	// last is the last bucket of each level, saved once the next one starts
+	last [maxLevel + 1]bucket
+}
+
+// Builder returns a builder of the ranks of the set, which must be empty
+func (s Set) Builder() *Builder {
+	b := &Builder{set: s}
+	for l := range b.last {
+		b.last[l] = bucket{boundary: []byte{headBoundary}}
+	}
+	return b
+}
+
+// Add adds the key to the ranks, it must come after the keys already added
+func (b *Builder) Add(key []byte) error {
+	boundary := encodeBoundary(key)
+	if bytes.Compare(boundary, b.last[0].boundary) <= 0 {
+		return fmt.Errorf("%w: key %x does not come after the keys already ranked", crud.ErrInternal, key)
+	}
+	keyLevel := level(key)
+	for l := range b.last {
+		if l > keyLevel {
+			b.last[l].count++
+			continue
+		}
+		b.last[l].next = boundary
+		b.set.save(l, b.last[l])
+		b.last[l] = bucket{boundary: boundary, count: 1}
+	}
+	return nil
+}
+
+// Close saves the last buckets, the ranks are complete once it returns
+func (b *Builder) Close() {
+	for l, last := range b.last {
+		b.set.save(l, last)
+	}
+}
+
+// bucketSize returns the number of keys from the boundary of a bucket of the given level to the boundary end,
+// or to the last key if end is nil, the buckets of the levels below are expected to be up to date
+func (s Set) bucketSize(l int, boundary, end []byte) (uint64, error) {
+	if l == 0 {
+		return 1, nil
+	}
+	var size uint64
+	for boundary != nil && !bytes.Equal(boundary, end) {
+		b, err := s.load(l-1, boundary)
+		if err != nil {
+			return 0, err
+		}
+		size += b.count
+		boundary = b.next
+	}
+	return size, nil
+}
+
+// load returns the bucket of the given level starting at the encoded boundary
+func (s Set) load(l int, boundary []byte) (bucket, error) {
+	b := bucket{boundary: boundary}
+	value := s.levelStore(l).Get(boundary)
+	if value == nil {
+		if boundary[0] == headBoundary {
+			// the head of an empty set is not saved
+			return b, nil
+		}
+		return b, fmt.Errorf("%w: missing bucket %x at level %d", crud.ErrInternal, boundary, l)
+	}
+	if l == 0 {
+		if boundary[0] != headBoundary {
+			b.count = 1
+		}
+	} else {
+		if len(value) < countLength {
+			return b, fmt.Errorf("%w: invalid bucket %x at level %d", crud.ErrInternal, boundary, l)
+		}
+		b.count, value = sdk.BigEndianToUint64(value[:countLength]), value[countLength:]
+	}
+	if len(value) != 0 {
+		b.next = value
+	}
+	return b, nil
+}
+
+// save saves the bucket to the given level, the head of an empty set is deleted
+func (s Set) save(l int, b bucket) {
+	levelStore := s.levelStore(l)
+	if b.boundary[0] == headBoundary && b.count == 0 && b.next == nil {
+		levelStore.Delete(b.boundary)
+		return
+	}
+	value := []byte{}
+	if l != 0 {
+		value = sdk.Uint64ToBigEndian(b.count)
+	}
+	levelStore.Set(b.boundary, append(value, b.next...))
+}
+
+// levelStore returns the store of the buckets of the given level
+func (s Set) levelStore(l int) sdk.KVStore {
+	return prefix.NewStore(s.buckets, []byte{byte(l)})
+}
+
+// level returns the highest level of the buckets the key is a boundary of
+func level(key []byte) int {
+	hash := sha256.Sum256(key)
+	zeros := 0
+	for _, b := range hash {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 || zeros >= levelBits*maxLevel {
+			break
+		}
+	}
+	if l := zeros / levelBits; l < maxLevel {
+		return l
+	}
+	return maxLevel
+}
+
+func encodeBoundary(key []byte) []byte {
+	return append([]byte{keyBoundaryPrefix}, key...)
+}
+
+// decodeBoundary returns the key an encoded boundary starts at, nil for the head boundary
+func decodeBoundary(boundary []byte) []byte {
+	if len(boundary) == 0 || boundary[0] == headBoundary {
+		return nil
+	}
+	return boundary[1:]
+}
@@ -0,0 +1,122 @@
+package ranks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/store/prefix"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/test"
+)
+
+func TestSet(t *testing.T) {
+	ctx, key, _, err := test.New()
+	if err != nil {
+		t.Fatalf("failed to create tests: %s", err)
+	}
+	db := ctx.KVStore(key)
+	keys := prefix.NewStore(db, []byte{0x0})
+	set := NewStore(prefix.NewStore(db, []byte{0x1})).Set([]byte("set"))
+
+	// checkRanks checks every key of the store is found at its rank
+	checkRanks := func(t *testing.T, expected [][]byte) {
+		count, err := set.Count()
+		test.CheckNoError(t, err)
+		if count != uint64(len(expected)) {
+			t.Fatalf("Unexpected count (expected : %d, actual : %d)", len(expected), count)
+		}
+		for rank, k := range expected {
+			actual, ok, err := set.Select(uint64(rank), false)
+			test.CheckNoError(t, err)
+			if !ok || !bytes.Equal(actual, k) {
+				t.Fatalf("Unexpected key at rank %d (expected : %s, actual : %s)", rank, k, actual)
+			}
+			actual, ok, err = set.Select(uint64(len(expected)-1-rank), true)
+			test.CheckNoError(t, err)
+			if !ok || !bytes.Equal(actual, k) {
+				t.Fatalf("Unexpected key at descending rank %d (expected : %s, actual : %s)", len(expected)-1-rank, k, actual)
+			}
+		}
+		for _, descending := range []bool{false, true} {
+			if actual, ok, err := set.Select(uint64(len(expected)), descending); err != nil || ok {
+				t.Fatalf("Unexpected key %s after the last rank", actual)
+			}
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		checkRanks(t, nil)
+	})
+
+	// add keys in random order, enough of them for several levels of buckets to be used
+	r := rand.New(rand.NewSource(1))
+	var expected [][]byte
+	for _, i := range r.Perm(5000) {
+		k := []byte(fmt.Sprintf("key%05d", i))
+		keys.Set(k, []byte{})
+		test.CheckNoError(t, set.Insert(k))
+		expected = append(expected, k)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i], expected[j]) < 0
+	})
+
+	t.Run("inserted keys", func(t *testing.T) {
+		checkRanks(t, expected)
+	})
+
+	t.Run("built keys", func(t *testing.T) {
+		// the buckets only depend on the keys, the built set must be saved as the set of the inserted keys
+		ranks := prefix.NewStore(db, []byte{0x1})
+		builder := NewStore(ranks).Set([]byte("built")).Builder()
+		for _, k := range expected {
+			test.CheckNoError(t, builder.Add(k))
+		}
+		builder.Close()
+		snapshot := func(id string) map[string]string {
+			kv := make(map[string]string)
+			it := prefix.NewStore(ranks, []byte(id)).Iterator(nil, nil)
+			defer it.Close()
+			for ; it.Valid(); it.Next() {
+				kv[string(it.Key())] = string(it.Value())
+			}
+			return kv
+		}
+		if built, inserted := snapshot("built"), snapshot("set"); !reflect.DeepEqual(built, inserted) {
+			t.Fatalf("Unexpected buckets (expected : %d buckets, actual : %d buckets)", len(inserted), len(built))
+		}
+		if err := builder.Add(expected[0]); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+	})
+
+	t.Run("removed keys", func(t *testing.T) {
+		remaining := make([][]byte, 0, len(expected))
+		for _, k := range expected {
+			if r.Intn(3) != 0 {
+				remaining = append(remaining, k)
+				continue
+			}
+			keys.Delete(k)
+			test.CheckNoError(t, set.Remove(k))
+		}
+		checkRanks(t, remaining)
+	})
+
+	t.Run("remove missing key", func(t *testing.T) {
+		// the missing key must be a bucket boundary for the error to be noticed
+		missing := []byte("missing")
+		for i := 0; level(missing) == 0; i++ {
+			missing = []byte(fmt.Sprintf("missing%d", i))
+		}
+		if err := set.Remove(missing); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error", err, "(expecting internal error)")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"fmt"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+)
+
+// Operator defines how a Predicate compares the values of an index
+// values are compared byte-wise, as bytes.Compare does
+type Operator uint8
+
+const (
+	// Equal matches the values equal to Predicate.Values[0]
+	Equal Operator = iota
+	// GreaterThan matches the values strictly greater than Predicate.Values[0]
+	GreaterThan
+	// GreaterOrEqual matches the values greater than or equal to Predicate.Values[0]
+	GreaterOrEqual
+	// LessThan matches the values strictly less than Predicate.Values[0]
+	LessThan
+	// LessOrEqual matches the values less than or equal to Predicate.Values[0]
+	LessOrEqual
+	// Between matches the values in the interval [Predicate.Values[0], Predicate.Values[1]]
+	Between
+	// Prefix matches the values starting with Predicate.Values[0]
+	Prefix
+	// In matches the values equal to any of Predicate.Values
+	In
+	// Exists matches any value, so that the objects having at least one value for the index are selected
+	// it has no operand
+	Exists
+)
+
+func (o Operator) String() string {
+	switch o {
+	case Equal:
+		return "equal"
+	case GreaterThan:
+		return "greater than"
+	case GreaterOrEqual:
+		return "greater or equal"
+	case LessThan:
+		return "less than"
+	case LessOrEqual:
+		return "less or equal"
+	case Between:
+		return "between"
+	case Prefix:
+		return "prefix"
+	case In:
+		return "in"
+	case Exists:
+		return "exists"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(o))
+	}
+}
+
+// Predicate defines a condition the values of an index must respect
+// for an object to be selected by a query
+type Predicate struct {
+	// ID is the index the condition applies to
+	ID crud.IndexID
+	// Operator defines how the index values are compared to Values
+	Operator Operator
+	// Values are the operands of the operator
+	Values [][]byte
+	// Composite defines if the index values are tuples of components built by crud.CompositeKey
+	// in which case the operator applies to the component following Components instead of the whole value
+	Composite bool
+	// Components are the leading components the composite index values must be equal to
+	Components [][]byte
+}
+
+// NewEqualityPredicate returns the predicate matching the objects having the given secondary key
+func NewEqualityPredicate(sk crud.SecondaryKey) Predicate {
+	return Predicate{
+		ID:       sk.ID,
+		Operator: Equal,
+		Values:   [][]byte{sk.Value},
+	}
+}
+
+// Conjunction defines a set of predicates an object must all respect to be selected by a query
+type Conjunction struct {
+	// Predicates are the predicates an object must respect, if empty all the objects respect them
+	Predicates []Predicate
+	// Exclusions are the predicates an object must not respect
+	Exclusions []Predicate
+}
+
+// Query describes a query built by the query package, which stores run through DoDirectQuery
+type Query struct {
+	// Conjunctions are the groups of predicates of the query, an object is selected
+	// if it matches at least one of them, all the objects are selected if there is none
+	Conjunctions []Conjunction
+	// Start and End define the interval [Start, End[ of the results to return, End being 0 means no limit
+	Start, End uint64
+	// Descending defines if the primary keys are returned in descending order instead of ascending order
+	Descending bool
+	// OrderBy is the index whose values define the order of the results, if nil they are ordered by primary key
+	OrderBy *crud.IndexID
+	// From is the position, given by types.Iterator.Position, of the first result to consider
+	// Start and End are relative to it, nil means the results are considered from the first one
+	From []byte
+	// Filters are checked against the decoded objects matching the conjunctions, the objects which do not pass
+	// all of them are not returned, Start and End apply to the objects passing them
+	Filters []Filter
+}
+
+// Filter is a condition on the decoded objects, for the conditions which cannot be answered by the indexes
+type Filter struct {
+	// NewObject returns the object the objects are decoded to, only the one of the first filter of a query is used
+	NewObject func() crud.Object
+	// Predicate returns true if the object passes the filter
+	Predicate func(o crud.Object) bool
+}
@@ -13,5 +13,11 @@ type Iterator interface {
 	Next()
 	Valid() bool
 	Get() []byte
+	// Position returns the position of the current key, an iteration
+	// starting from this position yields the current key first
+	Position() []byte
+	// Error returns the error which stopped the iteration before its end, if any
+	// it is checked once the iterator is not valid anymore
+	Error() error
 	Collect() [][]byte
 }
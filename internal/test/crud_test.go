@@ -14,6 +14,7 @@ import (
 	cdctypes "github.com/cosmos/cosmos-sdk/codec/types"
 	"github.com/cosmos/cosmos-sdk/store"
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/query"
 	"github.com/pkg/errors"
 	"github.com/tendermint/tendermint/libs/log"
 	"github.com/tendermint/tendermint/libs/rand"
@@ -29,6 +30,7 @@ const starnameDelimiter string = "*"
 const starnameOwnerIndex crud.IndexID = 0x1
 const starnameDomainIndex crud.IndexID = 0x2
 const starnameResourceIndex crud.IndexID = 0x3
+const starnameDomainOwnerIndex crud.IndexID = 0x4
 
 // assert Object is implemented by test objects
 var _ = crud.Object(NewTestStarname("", "", ""))
@@ -37,7 +39,7 @@ type TestStarname struct {
 	*types.TestStarname
 }
 
-func newStarnameStore() crud.Store {
+func newStarnameStore(options ...crud.OptionFunc) crud.Store {
 	interfaceRegistry := cdctypes.NewInterfaceRegistry()
 	interfaceRegistry.RegisterInterface("crud.internal.test",
 		(*crud.Object)(nil),
@@ -53,7 +55,7 @@ func newStarnameStore() crud.Store {
 	}
 	ctx := sdk.NewContext(ms, tmproto.Header{Time: time.Now()}, true, log.NewNopLogger())
 	db := ctx.KVStore(key)
-	return crudtypes.NewStore(cdc, db, nil)
+	return crudtypes.NewStore(cdc, db, nil, options...)
 }
 
 func NewTestStarnameWithResource(owner, domain, name, resource string) *TestStarname {
@@ -101,6 +103,10 @@ func (o TestStarname) SecondaryKeys() (secondaryKeys []crud.SecondaryKey) {
 	if len(o.Resource) != 0 {
 		sks = append(sks, crud.SecondaryKey{ID: starnameResourceIndex, Value: []byte(o.Resource)})
 	}
+	// index by domain, then owner
+	if len(o.Domain) != 0 && len(o.Owner) != 0 {
+		sks = append(sks, crud.CompositeKey(starnameDomainOwnerIndex, []byte(o.Domain), []byte(o.Owner)))
+	}
 	return sks
 }
 
@@ -204,6 +210,372 @@ func Test_Starname(t *testing.T) {
 		}
 
 	})
+	t.Run("success on range query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).GreaterThan([]byte(domains[1])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		n := 0
+		for ; cursor.Valid(); cursor.Next() {
+			actual := NewTestStarname("", "", "")
+			if err := cursor.Read(actual); err != nil {
+				t.Fatal("Unexpected error :", err)
+			}
+			if actual.Domain != domains[0] {
+				t.Fatalf("Got an unexpected result : expecting domain %v, got domain %v", domains[0], actual.Domain)
+			}
+			n++
+		}
+		if n != len(accounts) {
+			t.Fatalf("Missing values for query : expecting %v, got %v", len(accounts), n)
+		}
+	})
+	t.Run("success on prefix query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).HasPrefix([]byte("io")).
+			And().Index(starnameOwnerIndex).Equals([]byte(owners[0])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		n := 0
+		for ; cursor.Valid(); cursor.Next() {
+			actual := NewTestStarname("", "", "")
+			if err := cursor.Read(actual); err != nil {
+				t.Fatal("Unexpected error :", err)
+			}
+			if actual.Domain != domains[0] || actual.Owner != owners[0] {
+				t.Fatalf("Got an unexpected result : expecting domain %v and owner %v, got %v and %v", domains[0], owners[0], actual.Domain, actual.Owner)
+			}
+			n++
+		}
+		if n != len(accounts)/2 {
+			t.Fatalf("Missing values for query : expecting %v, got %v", len(accounts)/2, n)
+		}
+	})
+	t.Run("success on in query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameOwnerIndex).In([]byte(owners[0]), []byte(owners[1])).
+			And().Index(starnameDomainIndex).Equals([]byte(domains[0])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, []*TestStarname{
+			NewTestStarname(owners[0], domains[0], accounts[0]),
+			NewTestStarname(owners[1], domains[0], accounts[3]),
+			NewTestStarname(owners[1], domains[0], accounts[1]),
+			NewTestStarname(owners[0], domains[0], accounts[2]),
+		})
+	})
+	t.Run("success on or query", func(t *testing.T) {
+		cursor, err := store.Query().
+			Where().Index(starnameOwnerIndex).Equals([]byte(owners[0])).And().Index(starnameDomainIndex).Equals([]byte(domains[0])).
+			Or().Index(starnameOwnerIndex).Equals([]byte(owners[1])).And().Index(starnameDomainIndex).Equals([]byte(domains[1])).
+			Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, []*TestStarname{
+			NewTestStarname(owners[1], domains[1], accounts[0]),
+			NewTestStarname(owners[1], domains[1], accounts[2]),
+			NewTestStarname(owners[0], domains[0], accounts[0]),
+			NewTestStarname(owners[0], domains[0], accounts[2]),
+		})
+	})
+	t.Run("success on descending query", func(t *testing.T) {
+		cursor, err := store.Query().
+			Where().Index(starnameOwnerIndex).Equals([]byte(owners[0])).And().Index(starnameDomainIndex).Equals([]byte(domains[0])).
+			Or().Index(starnameOwnerIndex).Equals([]byte(owners[1])).And().Index(starnameDomainIndex).Equals([]byte(domains[1])).
+			Descending().Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, []*TestStarname{
+			NewTestStarname(owners[0], domains[0], accounts[2]),
+			NewTestStarname(owners[0], domains[0], accounts[0]),
+			NewTestStarname(owners[1], domains[1], accounts[2]),
+			NewTestStarname(owners[1], domains[1], accounts[0]),
+		})
+	})
+	t.Run("success on ranged descending select all", func(t *testing.T) {
+		cursor, err := store.Query().Descending().WithRange().Start(1).End(3).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		n := len(starnames)
+		checkStarnames(t, cursor, []*TestStarname{starnames[n-2], starnames[n-3]})
+	})
+	t.Run("success on ordered query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte(domains[0])).
+			OrderBy(starnameOwnerIndex).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, []*TestStarname{
+			NewTestStarname(owners[1], domains[0], accounts[3]),
+			NewTestStarname(owners[1], domains[0], accounts[1]),
+			NewTestStarname(owners[0], domains[0], accounts[0]),
+			NewTestStarname(owners[0], domains[0], accounts[2]),
+		})
+	})
+	t.Run("success on descending ordered select all", func(t *testing.T) {
+		cursor, err := store.Query().OrderBy(starnameOwnerIndex).Descending().Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		var expected []*TestStarname
+		for _, owner := range owners {
+			owned := starnamesByOwner[owner]
+			for i := len(owned) - 1; i >= 0; i-- {
+				expected = append(expected, owned[i])
+			}
+		}
+		checkStarnames(t, cursor, expected)
+	})
+	t.Run("success on resumed query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameOwnerIndex).Equals([]byte(owners[0])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		cursor.Next()
+		nextKey := cursor.NextKey()
+		cursor, err = store.Query().Where().Index(starnameOwnerIndex).Equals([]byte(owners[0])).ResumeFrom(nextKey).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, starnamesByOwner[owners[0]][1:])
+		if cursor.NextKey() != nil {
+			t.Fatal("Unexpected next key for consumed cursor", cursor.NextKey())
+		}
+	})
+	t.Run("success on paginated query", func(t *testing.T) {
+		orderedByOwner := append(append([]*TestStarname{}, starnamesByOwner[owners[1]]...), starnamesByOwner[owners[0]]...)
+		cases := []struct {
+			name     string
+			query    func() crud.ValidQuery
+			reverse  bool
+			expected []*TestStarname
+		}{
+			{
+				name:     "select all",
+				query:    func() crud.ValidQuery { return store.Query() },
+				expected: starnames,
+			},
+			{
+				name: "filtered",
+				query: func() crud.ValidQuery {
+					return store.Query().Where().Index(starnameOwnerIndex).Equals([]byte(owners[1]))
+				},
+				expected: starnamesByOwner[owners[1]],
+			},
+			{
+				name:     "ordered",
+				query:    func() crud.ValidQuery { return store.Query().OrderBy(starnameOwnerIndex) },
+				expected: orderedByOwner,
+			},
+		}
+		for _, c := range cases {
+			for _, reverse := range []bool{false, true} {
+				expected := append([]*TestStarname{}, c.expected...)
+				if reverse {
+					for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+						expected[i], expected[j] = expected[j], expected[i]
+					}
+				}
+				t.Run(fmt.Sprintf("%s/reverse=%t", c.name, reverse), func(t *testing.T) {
+					var actual []*TestStarname
+					onResult := func(cursor crud.Cursor) error {
+						starname := NewTestStarname("", "", "")
+						actual = append(actual, starname)
+						return cursor.Read(starname)
+					}
+					pageRequest := &query.PageRequest{Limit: 3, Reverse: reverse}
+					for pages := 0; ; pages++ {
+						if pages > len(expected) {
+							t.Fatal("Pagination does not end")
+						}
+						res, err := crud.Paginate(c.query(), pageRequest, onResult)
+						if err != nil {
+							t.Fatal("Unexpected error :", err)
+						}
+						if res.NextKey == nil {
+							break
+						}
+						pageRequest.Key = res.NextKey
+					}
+					if len(actual) != len(expected) {
+						t.Fatalf("Expected %d results, got %d", len(expected), len(actual))
+					}
+					for i := range expected {
+						if actual[i].Equals(expected[i]) != nil {
+							t.Fatalf("Starname mismatch at %d, expected %v, got %v", i, expected[i], actual[i])
+						}
+					}
+				})
+			}
+		}
+	})
+	t.Run("success on paginated query with offset and total", func(t *testing.T) {
+		var actual []*TestStarname
+		res, err := crud.Paginate(store.Query(), &query.PageRequest{Offset: 2, Limit: 3, CountTotal: true}, func(cursor crud.Cursor) error {
+			starname := NewTestStarname("", "", "")
+			actual = append(actual, starname)
+			return cursor.Read(starname)
+		})
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if res.Total != uint64(len(starnames)) {
+			t.Fatalf("Expected total %d, got %d", len(starnames), res.Total)
+		}
+		if res.NextKey == nil {
+			t.Fatal("Expected a next key")
+		}
+		if len(actual) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(actual))
+		}
+		for i, starname := range actual {
+			if starname.Equals(starnames[2+i]) != nil {
+				t.Fatalf("Starname mismatch at %d, expected %v, got %v", i, starnames[2+i], starname)
+			}
+		}
+	})
+	t.Run("bad argument on paginated query with offset and key", func(t *testing.T) {
+		_, err := crud.Paginate(store.Query(), &query.PageRequest{Offset: 2, Key: []byte("key")}, func(crud.Cursor) error { return nil })
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error :", err)
+		}
+	})
+	t.Run("success on count", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			query    crud.ValidQuery
+			expected uint64
+		}{
+			{
+				name:     "select all",
+				query:    store.Query(),
+				expected: uint64(len(starnames)),
+			},
+			{
+				name:     "select all with range",
+				query:    store.Query().WithRange().Start(2).End(5),
+				expected: 3,
+			},
+			{
+				name:     "equality",
+				query:    store.Query().Where().Index(starnameOwnerIndex).Equals([]byte(owners[0])),
+				expected: uint64(len(starnamesByOwner[owners[0]])),
+			},
+			{
+				name: "and",
+				query: store.Query().Where().Index(starnameOwnerIndex).Equals([]byte(owners[1])).
+					And().Index(starnameDomainIndex).Equals([]byte(domains[1])),
+				expected: 2,
+			},
+			{
+				name:     "no result",
+				query:    store.Query().Where().Index(starnameOwnerIndex).Equals([]byte("dave_")),
+				expected: 0,
+			},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				count, err := c.query.Count()
+				if err != nil {
+					t.Fatal("Unexpected error :", err)
+				}
+				if count != c.expected {
+					t.Fatalf("Expected count %d, got %d", c.expected, count)
+				}
+			})
+		}
+	})
+	t.Run("success on and not query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte(domains[0])).
+			AndNot().Index(starnameOwnerIndex).Equals([]byte(owners[0])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, []*TestStarname{
+			NewTestStarname(owners[1], domains[0], accounts[3]),
+			NewTestStarname(owners[1], domains[0], accounts[1]),
+		})
+	})
+	t.Run("success on composite index query", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			query    crud.ValidQuery
+			expected []*TestStarname
+		}{
+			{
+				name:  "equal components",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components([]byte(domains[0])).Equals([]byte(owners[0])),
+				expected: []*TestStarname{
+					NewTestStarname(owners[0], domains[0], accounts[0]),
+					NewTestStarname(owners[0], domains[0], accounts[2]),
+				},
+			},
+			{
+				name:  "leading component",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components().Equals([]byte(domains[1])),
+				expected: []*TestStarname{
+					NewTestStarname(owners[1], domains[1], accounts[0]),
+					NewTestStarname(owners[0], domains[1], accounts[3]),
+					NewTestStarname(owners[0], domains[1], accounts[1]),
+					NewTestStarname(owners[1], domains[1], accounts[2]),
+				},
+			},
+			{
+				name:  "range on leading component",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components().GreaterThan([]byte(domains[1])),
+				expected: []*TestStarname{
+					NewTestStarname(owners[0], domains[0], accounts[0]),
+					NewTestStarname(owners[1], domains[0], accounts[3]),
+					NewTestStarname(owners[1], domains[0], accounts[1]),
+					NewTestStarname(owners[0], domains[0], accounts[2]),
+				},
+			},
+			{
+				name:  "prefix on second component",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components([]byte(domains[1])).HasPrefix([]byte("ant")),
+				expected: []*TestStarname{
+					NewTestStarname(owners[1], domains[1], accounts[0]),
+					NewTestStarname(owners[1], domains[1], accounts[2]),
+				},
+			},
+			{
+				name:  "range on second component",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components([]byte(domains[0])).LessThan([]byte("b")),
+				expected: []*TestStarname{
+					NewTestStarname(owners[1], domains[0], accounts[3]),
+					NewTestStarname(owners[1], domains[0], accounts[1]),
+				},
+			},
+			{
+				name: "in on second component",
+				query: store.Query().Where().Index(starnameDomainOwnerIndex).Components([]byte(domains[0])).In([]byte(owners[1]), []byte("eve")).
+					And().Index(starnameDomainIndex).Equals([]byte(domains[0])),
+				expected: []*TestStarname{
+					NewTestStarname(owners[1], domains[0], accounts[3]),
+					NewTestStarname(owners[1], domains[0], accounts[1]),
+				},
+			},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				cursor, err := c.query.Do()
+				if err != nil {
+					t.Fatal("Unexpected error :", err)
+				}
+				checkStarnames(t, cursor, c.expected)
+			})
+		}
+	})
+	t.Run("success on not equals query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameOwnerIndex).NotEquals([]byte(owners[0])).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, starnamesByOwner[owners[1]])
+	})
 	t.Run("success on primary key", func(t *testing.T) {
 		for _, expected := range starnames {
 
@@ -296,6 +668,281 @@ func Test_Starname(t *testing.T) {
 	})
 }
 
+// checkStarnames checks the cursor yields the expected starnames, in order
+// Test_StarnameOptionalResource checks the queries on the presence of the resource, which is only indexed when set
+func Test_StarnameOptionalResource(t *testing.T) {
+	store := newStarnameStore()
+	withResource := []*TestStarname{
+		NewTestStarnameWithResource("dave", "cosmos", "binance", "wallet"),
+		NewTestStarnameWithResource("antoine", "iov", "coinbase", "wallet"),
+		NewTestStarnameWithResource("dave", "iov", "kraken", "website"),
+	}
+	withoutResource := []*TestStarname{
+		NewTestStarnameWithResource("antoine", "cosmos", "kraken", ""),
+		NewTestStarnameWithResource("dave", "iov", "binance", ""),
+	}
+	for _, starname := range append(withResource, withoutResource...) {
+		if err := store.Create(starname); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name     string
+		query    crud.ValidQuery
+		expected []*TestStarname
+	}{
+		{
+			name:     "exists",
+			query:    store.Query().Where().Index(starnameResourceIndex).Exists(),
+			expected: withResource,
+		},
+		{
+			name:     "missing",
+			query:    store.Query().Where().Index(starnameResourceIndex).Missing(),
+			expected: withoutResource,
+		},
+		{
+			name: "exists and equals",
+			query: store.Query().Where().Index(starnameOwnerIndex).Equals([]byte("dave")).
+				And().Index(starnameResourceIndex).Exists(),
+			expected: []*TestStarname{withResource[0], withResource[2]},
+		},
+		{
+			name: "missing and equals",
+			query: store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).
+				And().Index(starnameResourceIndex).Missing(),
+			expected: []*TestStarname{withoutResource[1]},
+		},
+		{
+			name: "descending exists",
+			query: store.Query().Where().Index(starnameResourceIndex).Exists().
+				Descending(),
+			expected: []*TestStarname{withResource[2], withResource[1], withResource[0]},
+		},
+		{
+			name:     "exists on composite components",
+			query:    store.Query().Where().Index(starnameDomainOwnerIndex).Components([]byte("iov")).Exists(),
+			expected: []*TestStarname{withoutResource[1], withResource[1], withResource[2]},
+		},
+		{
+			name:  "exists on unused index",
+			query: store.Query().Where().Index(0x10).Exists(),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cursor, err := c.query.Do()
+			if err != nil {
+				t.Fatal("Unexpected error :", err)
+			}
+			checkStarnames(t, cursor, c.expected)
+		})
+	}
+	t.Run("count", func(t *testing.T) {
+		count, err := store.Query().Where().Index(starnameResourceIndex).Missing().Count()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if count != uint64(len(withoutResource)) {
+			t.Fatalf("Expected count %d, got %d", len(withoutResource), count)
+		}
+	})
+}
+
+// Test_StarnameFilter checks the conditions on decoded objects, whose range applies after filtering
+func Test_StarnameFilter(t *testing.T) {
+	store := newStarnameStore()
+	var expected []*TestStarname
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("name%02d", i)
+		if i%3 == 0 {
+			name = fmt.Sprintf("account%02d", i)
+		}
+		starname := NewTestStarname("dave", "iov", name)
+		if err := store.Create(starname); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 != 0 && i%2 == 0 {
+			expected = append(expected, starname)
+		}
+	}
+	// even names which are not accounts, in primary key order
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i].PrimaryKey(), expected[j].PrimaryKey()) < 0
+	})
+	newObj := func() crud.Object { return NewTestStarname("", "", "") }
+	pred := func(o crud.Object) bool {
+		name := *o.(*TestStarname).Name
+		return strings.HasPrefix(name, "name") && (name[len(name)-1]-'0')%2 == 0
+	}
+	t.Run("success on filtered query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newObj, pred).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, expected)
+	})
+	t.Run("success on ranged filtered query", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newObj, pred).
+			WithRange().Start(2).End(5).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		checkStarnames(t, cursor, expected[2:5])
+	})
+	t.Run("success on count of filtered query", func(t *testing.T) {
+		count, err := store.Query().Where().Index(starnameOwnerIndex).Equals([]byte("dave")).Filter(newObj, pred).
+			WithRange().Start(1).End(0).Count()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if count != uint64(len(expected)-1) {
+			t.Fatalf("Expected count %d, got %d", len(expected)-1, count)
+		}
+	})
+	t.Run("success on paginated filtered query", func(t *testing.T) {
+		var actual []*TestStarname
+		var key []byte
+		for {
+			q := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newObj, pred)
+			page, err := crud.Paginate(q, &query.PageRequest{Key: key, Limit: 2}, func(cursor crud.Cursor) error {
+				starname := NewTestStarname("", "", "")
+				actual = append(actual, starname)
+				return cursor.Read(starname)
+			})
+			if err != nil {
+				t.Fatal("Unexpected error :", err)
+			}
+			if page.NextKey == nil {
+				break
+			}
+			key = page.NextKey
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %d starnames, got %d", len(expected), len(actual))
+		}
+		for i := range expected {
+			if err := actual[i].Equals(expected[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	t.Run("bad argument on nil filter", func(t *testing.T) {
+		_, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newObj, nil).Do()
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("Unexpected error :", err)
+		}
+	})
+	t.Run("objects decoded once", func(t *testing.T) {
+		decoded := 0
+		newCounting := func() crud.Object {
+			return &countingStarname{TestStarname: NewTestStarname("", "", ""), decoded: &decoded}
+		}
+		countingPred := func(o crud.Object) bool {
+			return pred(o.(*countingStarname).TestStarname)
+		}
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newCounting, countingPred).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		var actual []*TestStarname
+		for ; cursor.Valid(); cursor.Next() {
+			starname := newCounting().(*countingStarname)
+			if err := cursor.Read(starname); err != nil {
+				t.Fatal("Unexpected error :", err)
+			}
+			actual = append(actual, starname.TestStarname)
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %d starnames, got %d", len(expected), len(actual))
+		}
+		for i := range expected {
+			if err := actual[i].Equals(expected[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the objects are decoded to be filtered, the cursor reads the decoded objects
+		if decoded != 20 {
+			t.Fatalf("Expected 20 decoded objects, got %d", decoded)
+		}
+	})
+	t.Run("error on undecodable objects", func(t *testing.T) {
+		undecodable := func() crud.Object { return undecodableStarname{NewTestStarname("", "", "")} }
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(undecodable, pred).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if cursor.Valid() {
+			t.Fatal("The cursor should have stopped")
+		}
+		if err := cursor.Error(); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error :", err)
+		}
+		_, err = store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(undecodable, pred).Count()
+		if !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("Unexpected error :", err)
+		}
+	})
+	t.Run("read after update", func(t *testing.T) {
+		cursor, err := store.Query().Where().Index(starnameDomainIndex).Equals([]byte("iov")).Filter(newObj, pred).Do()
+		if err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		updated := NewTestStarnameWithResource("dave", "iov", *expected[0].Name, "updated")
+		if err := cursor.Update(updated); err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		// the object decoded for the filters is not read anymore
+		actual := NewTestStarname("", "", "")
+		if err := cursor.Read(actual); err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if actual.Resource != "updated" {
+			t.Fatalf("Expected the updated starname, got %v", actual)
+		}
+	})
+}
+
+// countingStarname is a starname which counts the times it is decoded
+type countingStarname struct {
+	*TestStarname
+	decoded *int
+}
+
+func (o *countingStarname) Unmarshal(b []byte) error {
+	*o.decoded++
+	return o.TestStarname.Unmarshal(b)
+}
+
+// undecodableStarname is a starname which cannot be decoded
+type undecodableStarname struct {
+	*TestStarname
+}
+
+func (o undecodableStarname) Unmarshal([]byte) error {
+	return fmt.Errorf("undecodable starname")
+}
+
+func checkStarnames(t *testing.T, cursor crud.Cursor, expected []*TestStarname) {
+	i := 0
+	for ; cursor.Valid(); cursor.Next() {
+		if i == len(expected) {
+			t.Fatal("Too many results for query")
+		}
+		actual := NewTestStarname("", "", "")
+		if err := cursor.Read(actual); err != nil {
+			t.Fatal("Unexpected error :", err)
+		}
+		if actual.Equals(expected[i]) != nil {
+			t.Fatalf("Starname mismatch, expected %v, got %v", expected[i], actual)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Fatalf("Missing values for query : expecting %v, got %v", len(expected), i)
+	}
+}
+
 func BenchmarkQuerySimple_1000_Objs(b *testing.B) {
 	benchmarkSingleQuery(b, 1000)
 }
@@ -322,6 +969,81 @@ func BenchmarkQueryAnded_1000000_Objs(b *testing.B) {
 	benchmarkAndedQuery(b, 1000000)
 }
 
+// The skewed benchmarks intersect a clause matching all the objects with one matching 100 of them,
+// spread over the whole store, the clause matching all the objects being written first
+func BenchmarkQuerySkewedAnded_1000_Objs(b *testing.B) {
+	benchmarkSkewedAndedQuery(b, 1000)
+}
+func BenchmarkQuerySkewedAnded_10000_Objs(b *testing.B) {
+	benchmarkSkewedAndedQuery(b, 10000)
+}
+func BenchmarkQuerySkewedAnded_100000_Objs(b *testing.B) {
+	benchmarkSkewedAndedQuery(b, 100000)
+}
+func BenchmarkQuerySkewedAnded_1000000_Objs(b *testing.B) {
+	benchmarkSkewedAndedQuery(b, 1000000)
+}
+
+// The seek benchmarks intersect the clause matching all the objects with a prefix clause matching 100 of them,
+// whose size is unknown, so that the iterator over all the objects has to skip ahead to the few matching keys
+func BenchmarkQuerySeekAnded_1000_Objs(b *testing.B) {
+	benchmarkSeekAndedQuery(b, 1000)
+}
+func BenchmarkQuerySeekAnded_10000_Objs(b *testing.B) {
+	benchmarkSeekAndedQuery(b, 10000)
+}
+func BenchmarkQuerySeekAnded_100000_Objs(b *testing.B) {
+	benchmarkSeekAndedQuery(b, 100000)
+}
+func BenchmarkQuerySeekAnded_1000000_Objs(b *testing.B) {
+	benchmarkSeekAndedQuery(b, 1000000)
+}
+
+// The offset benchmarks query the last 10 objects of an index value matching all the objects,
+// the ranked ones use a store maintaining the ranks of the primary keys
+func BenchmarkQueryOffset_1000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 1000, false)
+}
+func BenchmarkQueryOffset_10000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 10000, false)
+}
+func BenchmarkQueryOffset_100000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 100000, false)
+}
+func BenchmarkQueryRankedOffset_1000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 1000, true)
+}
+func BenchmarkQueryRankedOffset_10000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 10000, true)
+}
+func BenchmarkQueryRankedOffset_100000_Objs(b *testing.B) {
+	benchmarkOffsetQuery(b, 100000, true)
+}
+
+// The range benchmarks query the first 10 objects whose owner, distinct for every object, has a given prefix:
+// the index keys of all the owners in the interval are visited before the first object is returned
+func BenchmarkQueryRange_1000_Objs(b *testing.B) {
+	benchmarkRangeQuery(b, 1000)
+}
+func BenchmarkQueryRange_10000_Objs(b *testing.B) {
+	benchmarkRangeQuery(b, 10000)
+}
+func BenchmarkQueryRange_100000_Objs(b *testing.B) {
+	benchmarkRangeQuery(b, 100000)
+}
+
+// The ordered benchmarks query the 100 objects of a domain ordered by owner:
+// the objects are read from the index keys of the domain instead of walking the owners of all the objects
+func BenchmarkQueryOrdered_1000_Objs(b *testing.B) {
+	benchmarkOrderedQuery(b, 1000)
+}
+func BenchmarkQueryOrdered_10000_Objs(b *testing.B) {
+	benchmarkOrderedQuery(b, 10000)
+}
+func BenchmarkQueryOrdered_100000_Objs(b *testing.B) {
+	benchmarkOrderedQuery(b, 100000)
+}
+
 func BenchmarkQueryAll_1000_Objs(b *testing.B) {
 	benchmarkQueryAll(b, 1000)
 }
@@ -336,6 +1058,44 @@ func BenchmarkQueryAll_1000000_Objs(b *testing.B) {
 	benchmarkQueryAll(b, 1000000)
 }
 
+// The create many benchmarks create nbObjects objects in a single batch, in an empty store,
+// the time per object must not grow with the size of the batch
+func BenchmarkCreateMany_1000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 1000)
+}
+func BenchmarkCreateMany_4000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 4000)
+}
+func BenchmarkCreateMany_16000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 16000)
+}
+func BenchmarkRankedCreateMany_1000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 1000, crudtypes.WithRanks())
+}
+func BenchmarkRankedCreateMany_4000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 4000, crudtypes.WithRanks())
+}
+func BenchmarkRankedCreateMany_16000_Objs(b *testing.B) {
+	benchmarkCreateMany(b, 16000, crudtypes.WithRanks())
+}
+
+// benchmarkCreateMany benchmarks the creation of nbObjects objects with CreateMany in a store built with the given options
+func benchmarkCreateMany(b *testing.B, nbObjects int, options ...crud.OptionFunc) {
+	objects := make([]crud.Object, nbObjects)
+	for i := range objects {
+		objects[i] = NewTestStarname(fmt.Sprintf("owner%x", i%10), fmt.Sprintf("domain%x", i/100), fmt.Sprintf("name%x", i))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		s := newStarnameStore(options...)
+		b.StartTimer()
+		if err := s.CreateMany(objects); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func benchmarkSingleQuery(b *testing.B, nbObjects int) {
 	benchmarkQuery(b, nbObjects, func(query crud.QueryStatement) (crud.Cursor, error) {
 		return query.Where().Index(starnameDomainIndex).Equals([]byte("domain1")).Do()
@@ -349,11 +1109,62 @@ func benchmarkAndedQuery(b *testing.B, nbObjects int) {
 	})
 }
 
+func benchmarkSkewedAndedQuery(b *testing.B, nbObjects int) {
+	if _, ok := skewedTestStores[nbObjects]; !ok {
+		skewedTestStores[nbObjects] = starnameStoreWithSkewedObjects(nbObjects)
+	}
+	benchmarkStoreQuery(b, skewedTestStores[nbObjects], func(query crud.QueryStatement) (crud.Cursor, error) {
+		return query.Where().Index(starnameOwnerIndex).Equals([]byte(skewedOwner)).
+			And().Index(starnameResourceIndex).Equals([]byte(skewedResource)).Do()
+	})
+}
+
+func benchmarkSeekAndedQuery(b *testing.B, nbObjects int) {
+	if _, ok := skewedTestStores[nbObjects]; !ok {
+		skewedTestStores[nbObjects] = starnameStoreWithSkewedObjects(nbObjects)
+	}
+	benchmarkStoreQuery(b, skewedTestStores[nbObjects], func(query crud.QueryStatement) (crud.Cursor, error) {
+		return query.Where().Index(starnameOwnerIndex).Equals([]byte(skewedOwner)).
+			And().Index(starnameResourceIndex).HasPrefix([]byte(skewedResource)).Do()
+	})
+}
+
+func benchmarkOffsetQuery(b *testing.B, nbObjects int, ranked bool) {
+	stores := skewedTestStores
+	var options []crud.OptionFunc
+	if ranked {
+		stores = rankedTestStores
+		options = append(options, crudtypes.WithRanks())
+	}
+	if _, ok := stores[nbObjects]; !ok {
+		stores[nbObjects] = starnameStoreWithSkewedObjects(nbObjects, options...)
+	}
+	start := uint64(nbObjects - 10)
+	benchmarkStoreQuery(b, stores[nbObjects], func(query crud.QueryStatement) (crud.Cursor, error) {
+		return query.Where().Index(starnameOwnerIndex).Equals([]byte(skewedOwner)).
+			WithRange().Start(start).End(start + 10).Do()
+	})
+}
+
+func benchmarkRangeQuery(b *testing.B, nbObjects int) {
+	benchmarkQuery(b, nbObjects, func(query crud.QueryStatement) (crud.Cursor, error) {
+		return query.Where().Index(starnameOwnerIndex).HasPrefix([]byte("star")).WithRange().Start(0).End(10).Do()
+	})
+}
+
+func benchmarkOrderedQuery(b *testing.B, nbObjects int) {
+	benchmarkQuery(b, nbObjects, func(query crud.QueryStatement) (crud.Cursor, error) {
+		return query.Where().Index(starnameDomainIndex).Equals([]byte("domain1")).OrderBy(starnameOwnerIndex).Do()
+	})
+}
+
 func benchmarkQueryAll(b *testing.B, nbObjects int) {
 	benchmarkQuery(b, nbObjects, crud.QueryStatement.Do)
 }
 
 var testStores map[int]crud.Store = make(map[int]crud.Store)
+var skewedTestStores map[int]crud.Store = make(map[int]crud.Store)
+var rankedTestStores map[int]crud.Store = make(map[int]crud.Store)
 
 // benchmarkQuery benchmarks a simple query in a store with nbObjects objects
 // This allows to detect if the query execution time evolves non-linearly with the number of objects in the store
@@ -362,7 +1173,11 @@ func benchmarkQuery(b *testing.B, nbObjects int, doQuery func(crud.QueryStatemen
 	if _, ok := testStores[nbObjects]; !ok {
 		testStores[nbObjects] = starnameStoreWithRandomObjects(nbObjects)
 	}
-	s := testStores[nbObjects]
+	benchmarkStoreQuery(b, testStores[nbObjects], doQuery)
+}
+
+// benchmarkStoreQuery benchmarks a query on the given store, reading all the objects it returns
+func benchmarkStoreQuery(b *testing.B, s crud.Store, doQuery func(crud.QueryStatement) (crud.Cursor, error)) {
 	obj := NewTestStarname("", "", "")
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
@@ -396,6 +1211,32 @@ func starnameStoreWithRandomObjects(nbObjects int) crud.Store {
 	return s
 }
 
+// skewedOwner is the owner of all the objects of the stores built by starnameStoreWithSkewedObjects
+const skewedOwner = "star1skewed"
+
+// skewedResource is the resource of 100 objects of the stores built by starnameStoreWithSkewedObjects
+const skewedResource = "skewed"
+
+// starnameStoreWithSkewedObjects builds a store whose objects all have the same owner
+// and where one object out of nbObjects/100 has the skewed resource
+func starnameStoreWithSkewedObjects(nbObjects int, options ...crud.OptionFunc) crud.Store {
+	s := newStarnameStore(options...)
+
+	for i := 0; i < nbObjects; i++ {
+		generatedDomain := "domain" + fmt.Sprintf("%x", i/100)
+		generatedName := "name" + fmt.Sprintf("%x", i%1000)
+		resource := "unused"
+		if i%(nbObjects/100) == 0 {
+			resource = skewedResource
+		}
+		starname := NewTestStarnameWithResource(skewedOwner, generatedDomain, generatedName, resource)
+		if err := s.Create(starname); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
 func debugStarname(starname *TestStarname) {
 	fmt.Printf("%16s %-32x %v %v\n", starname.GetStarname(), starname.PrimaryKey(), starname.SecondaryKeys()[0], starname.SecondaryKeys()[1])
 }
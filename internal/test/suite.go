@@ -198,6 +198,25 @@ func CreateRandomObjects(add func(crud.Object) error, t *testing.T, n int) []cru
 	return objs
 }
 
+// CursorKeys returns the primary keys of the objects of the cursor, which is consumed
+func CursorKeys(t *testing.T, crs crud.Cursor) []string {
+	var pks []string
+	for ; crs.Valid(); crs.Next() {
+		obj := NewObject()
+		CheckNoError(t, crs.Read(obj))
+		pks = append(pks, string(obj.PrimaryKey()))
+	}
+	CheckNoError(t, crs.Error())
+	return pks
+}
+
+// QueryKeys returns the primary keys of the objects the query returns
+func QueryKeys(t *testing.T, q crud.ValidQuery) []string {
+	crs, err := q.Do()
+	CheckNoError(t, err)
+	return CursorKeys(t, crs)
+}
+
 func CheckNoError(t *testing.T, err error) {
 	if err != nil {
 		t.Fatal("Unexpected error : ", err)
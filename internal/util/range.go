@@ -23,6 +23,23 @@ type Range struct {
 	index      uint64
 }
 
+// Length returns the number of indexes of the interval [0, total[ which are in the range
+func (r *Range) Length(total uint64) uint64 {
+	if r.end != 0 && r.end < total {
+		total = r.end
+	}
+	if total <= r.start {
+		return 0
+	}
+	return total - r.start
+}
+
+// Skip moves the internal iterator forward by n elements, as n calls to CheckAndMoveForward would
+// it is used when the elements before the range are skipped without going through them
+func (r *Range) Skip(n uint64) {
+	r.index += n
+}
+
 // CheckAndMoveForward Returns current range status and moves the internal iterator forward
 // inRange is true if the iterator is in the range [start, end[
 // stopIter is true if the iterator reached the end of the interval
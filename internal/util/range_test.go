@@ -102,6 +102,27 @@ func TestRange(t *testing.T) {
 		}
 	})
 
+	t.Run("length", func(t *testing.T) {
+		cases := []struct {
+			start, end, total, expected uint64
+		}{
+			{start: 0, end: 0, total: 10, expected: 10},
+			{start: 3, end: 0, total: 10, expected: 7},
+			{start: 3, end: 5, total: 10, expected: 2},
+			{start: 3, end: 15, total: 10, expected: 7},
+			{start: 12, end: 15, total: 10, expected: 0},
+			{start: 10, end: 0, total: 10, expected: 0},
+			{start: 0, end: 0, total: 0, expected: 0},
+		}
+		for _, c := range cases {
+			r, err := NewRange(c.start, c.end)
+			checkErr(t, err)
+			if actual := r.Length(c.total); actual != c.expected {
+				t.Fatalf("Wrong length for range [%d, %d[ over %d elements (expecting %d, actual %d)", c.start, c.end, c.total, c.expected, actual)
+			}
+		}
+	})
+
 }
 
 func checkErr(t *testing.T, err error) {
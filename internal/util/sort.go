@@ -24,3 +24,37 @@ func BytesBiggerEqual(a, b []byte) (isGreater, isEqual bool) {
 	isEqual = comp == 0
 	return
 }
+
+// BytesBefore returns true if a comes before b in the given iteration order
+// which is descending if descending is true, ascending otherwise
+func BytesBefore(a, b []byte, descending bool) bool {
+	if descending {
+		return BytesSmaller(b, a)
+	}
+	return BytesSmaller(a, b)
+}
+
+// IteratorBounds returns the bounds to give to a store iterator in order to iterate over
+// the keys coming from the given key included in the given iteration order, nil meaning the first key
+func IteratorBounds(from []byte, descending bool) (start, end []byte) {
+	if from == nil {
+		return nil, nil
+	}
+	if descending {
+		// the end bound is exclusive, the smallest key greater than from is from followed by a 0x00 byte
+		end = make([]byte, len(from), len(from)+1)
+		copy(end, from)
+		return nil, append(end, 0x00)
+	}
+	return from, nil
+}
+
+// BytesAfterEqual is BytesBiggerEqual for the given iteration order
+// which is descending if descending is true, ascending otherwise
+func BytesAfterEqual(a, b []byte, descending bool) (isAfter, isEqual bool) {
+	if descending {
+		isAfter, isEqual = BytesBiggerEqual(b, a)
+		return
+	}
+	return BytesBiggerEqual(a, b)
+}
@@ -0,0 +1,39 @@
+package util
+
+// tupleEscapeByte is the byte that needs to be escaped in tuple components, as it is used in the terminator
+const tupleEscapeByte = 0x00
+
+// tupleEscapedByte is the byte following tupleEscapeByte when tupleEscapeByte is part of a component
+const tupleEscapedByte = 0xFF
+
+// tupleTerminatorByte is the byte following tupleEscapeByte when a component is over
+const tupleTerminatorByte = 0x01
+
+// AppendTupleComponent appends the component to the encoded tuple
+// each component is encoded as <escape(component)><0x00,0x01>, where escape replaces every 0x00 byte with 0x00,0xFF,
+// so that encoded tuples are sorted by their first component, then by their second one, and so on.
+func AppendTupleComponent(tuple, component []byte) []byte {
+	return append(AppendTuplePrefix(tuple, component), tupleEscapeByte, tupleTerminatorByte)
+}
+
+// AppendTuplePrefix appends the escaped prefix to the encoded tuple, without terminator
+// so the result is the prefix of the encoded tuples whose next component starts with prefix
+func AppendTuplePrefix(tuple, prefix []byte) []byte {
+	for _, b := range prefix {
+		if b == tupleEscapeByte {
+			tuple = append(tuple, tupleEscapeByte, tupleEscapedByte)
+			continue
+		}
+		tuple = append(tuple, b)
+	}
+	return tuple
+}
+
+// EncodeTuple encodes the components as a tuple, see AppendTupleComponent
+func EncodeTuple(components ...[]byte) []byte {
+	var tuple []byte
+	for _, c := range components {
+		tuple = AppendTupleComponent(tuple, c)
+	}
+	return tuple
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeTuple(t *testing.T) {
+	// tuples sorted by their first component, then by their second one
+	sorted := [][][]byte{
+		{{}, []byte("z")},
+		{[]byte("a")},
+		{[]byte("a"), {}},
+		{[]byte("a"), []byte("x")},
+		{[]byte("a"), []byte("x\x00")},
+		{[]byte("a"), []byte("x\x01")},
+		{[]byte("a"), []byte("xy")},
+		{[]byte("a\x00"), []byte("a")},
+		{[]byte("a\x00\x00")},
+		{[]byte("a\x01")},
+		{[]byte("ab")},
+	}
+	for i := 1; i < len(sorted); i++ {
+		previous, current := EncodeTuple(sorted[i-1]...), EncodeTuple(sorted[i]...)
+		if bytes.Compare(previous, current) >= 0 {
+			t.Fatalf("Tuple %q encoded as %x should come before tuple %q encoded as %x", sorted[i-1], previous, sorted[i], current)
+		}
+	}
+
+	t.Run("prefix", func(t *testing.T) {
+		tuple := EncodeTuple([]byte("a"), []byte("x\x00y"))
+		if !bytes.HasPrefix(tuple, AppendTuplePrefix(EncodeTuple([]byte("a")), []byte("x\x00"))) {
+			t.Fatal("The encoded prefix of the second component should prefix the tuple")
+		}
+		if bytes.HasPrefix(tuple, AppendTupleComponent(EncodeTuple([]byte("a")), []byte("x"))) {
+			t.Fatal("The encoded second component should not prefix a tuple with another second component")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package crud
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cosmos/cosmos-sdk/types/query"
+)
+
+// Paginate runs the query for the page described by the cosmos-sdk page request and calls onResult
+// for each object of the page, with the cursor positioned on it. It follows query.Paginate semantics:
+// the page starts either at the next key returned by a previous page or at an offset, the limit defaults
+// to query.DefaultLimit, in which case the total is counted, and the total is only counted for offset based pages.
+// The query must not have a range, as Paginate sets it.
+func Paginate(q ValidQuery, pageRequest *query.PageRequest, onResult func(cursor Cursor) error) (*query.PageResponse, error) {
+	// if the PageRequest is nil, use default PageRequest
+	if pageRequest == nil {
+		pageRequest = &query.PageRequest{}
+	}
+	offset := pageRequest.Offset
+	limit := pageRequest.Limit
+	countTotal := pageRequest.CountTotal && pageRequest.Key == nil
+	if offset > 0 && pageRequest.Key != nil {
+		return nil, fmt.Errorf("%w: invalid page request, either offset or key is expected, got both", ErrBadArgument)
+	}
+	if limit == 0 {
+		limit = query.DefaultLimit
+		countTotal = pageRequest.Key == nil
+	}
+
+	if pageRequest.Reverse {
+		q = q.Descending()
+	}
+	if pageRequest.Key != nil {
+		q = q.ResumeFrom(pageRequest.Key)
+	}
+	// the total requires to go over all the objects, otherwise the page and the next key are enough
+	skip := offset
+	if !countTotal {
+		end := offset + limit + 1
+		if limit >= math.MaxUint64-offset {
+			end = 0
+		}
+		q = q.WithRange().Start(offset).End(end)
+		skip = 0
+	}
+	cursor, err := q.Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint64
+	for ; cursor.Valid() && count < skip; cursor.Next() {
+		count++
+	}
+	for n := uint64(0); cursor.Valid() && n < limit; cursor.Next() {
+		if err := onResult(cursor); err != nil {
+			return nil, err
+		}
+		count++
+		n++
+	}
+	if err := cursor.Error(); err != nil {
+		return nil, err
+	}
+	res := &query.PageResponse{NextKey: cursor.NextKey()}
+	if countTotal {
+		for ; cursor.Valid(); cursor.Next() {
+			count++
+		}
+		if err := cursor.Error(); err != nil {
+			return nil, err
+		}
+		res.Total = count
+	}
+	return res, nil
+}
@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is the kind of a token of a query text
+type tokenKind uint8
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord is an index name or a keyword
+	tokenWord
+	// tokenString is a double quoted string value
+	tokenString
+	// tokenHex is a 0x prefixed hexadecimal value
+	tokenHex
+	// tokenNumber is a decimal number, used by ranges
+	tokenNumber
+	// tokenSymbol is an operator or a punctuation
+	tokenSymbol
+)
+
+// token is a lexical unit of a query text
+type token struct {
+	kind tokenKind
+	// text is the token as written in the query text
+	text string
+	// value is the value of a string or hexadecimal token
+	value []byte
+	// pos is the byte offset of the token in the query text
+	pos int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// is checks if the token is the given keyword or symbol, keywords are case insensitive
+func (t token) is(s string) bool {
+	switch t.kind {
+	case tokenWord:
+		return strings.EqualFold(t.text, s)
+	case tokenSymbol:
+		return t.text == s
+	default:
+		return false
+	}
+}
+
+// symbols are the operators and punctuations, the longest ones first so that they are matched before their prefixes
+var symbols = []string{"!=", ">=", "<=", "..", "=", ">", "<", "(", ")", ","}
+
+// lex splits the query text into tokens, the last one being tokenEOF
+func lex(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; ; {
+		// skip spaces
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		if i == len(text) {
+			return append(tokens, token{kind: tokenEOF, pos: i}), nil
+		}
+		tok, err := lexToken(text, i)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		i += len(tok.text)
+	}
+}
+
+// lexToken reads the token starting at the position pos of the text
+func lexToken(text string, pos int) (token, error) {
+	c := text[pos]
+	switch {
+	case c == '"':
+		// the string ends at the first unescaped quote
+		end := pos + 1
+		for ; end < len(text) && text[end] != '"'; end++ {
+			if text[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(text) {
+			return token{}, newError(pos, "unterminated string")
+		}
+		raw := text[pos : end+1]
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return token{}, newError(pos, "invalid string %s: %s", raw, err)
+		}
+		return token{kind: tokenString, text: raw, value: []byte(value), pos: pos}, nil
+	case strings.HasPrefix(text[pos:], "0x") || strings.HasPrefix(text[pos:], "0X"):
+		end := scan(text, pos+2, isAlphanumeric)
+		raw := text[pos:end]
+		value, err := hex.DecodeString(raw[2:])
+		if err != nil {
+			return token{}, newError(pos, "invalid hexadecimal value %s: %s", raw, err)
+		}
+		return token{kind: tokenHex, text: raw, value: value, pos: pos}, nil
+	case isDigit(c):
+		end := scan(text, pos, isDigit)
+		return token{kind: tokenNumber, text: text[pos:end], pos: pos}, nil
+	case isLetter(c):
+		end := scan(text, pos, isWordByte)
+		return token{kind: tokenWord, text: text[pos:end], pos: pos}, nil
+	}
+	for _, s := range symbols {
+		if strings.HasPrefix(text[pos:], s) {
+			return token{kind: tokenSymbol, text: s, pos: pos}, nil
+		}
+	}
+	return token{}, newError(pos, "unexpected character %q", c)
+}
+
+// scan returns the position of the first byte from pos which is not accepted
+func scan(text string, pos int, accept func(byte) bool) int {
+	for pos < len(text) && accept(text[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '_'
+}
+
+func isAlphanumeric(c byte) bool {
+	return isLetter(c) || isDigit(c)
+}
+
+// isWordByte checks if the byte can be part of an index name or keyword
+func isWordByte(c byte) bool {
+	return isAlphanumeric(c) || c == '-'
+}
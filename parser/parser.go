@@ -0,0 +1,377 @@
+// Package parser turns textual queries into crud.QueryStatement calls, for command line tools, REST query parameters
+// and test fixtures. A query is a list of conditions on indexes, followed by modifiers:
+//
+//	owner = "star1..." AND domain = "iov" RANGE 0..50
+//
+// The conditions are joined by AND, AND NOT and OR, AND binding tighter than OR as with the query methods,
+// and can be grouped in parentheses, as crud.WhereStatement.Group does: domain = "iov" AND (owner = "a" OR owner = "b").
+// A condition applies to an index, named through a Registry, and is one of:
+//
+//	name = value, name != value, name > value, name >= value, name < value, name <= value
+//	name PREFIX value
+//	name BETWEEN value AND value
+//	name IN (value, ...)
+//	name CONTAINS ALL (value, ...), name CONTAINS ANY (value, ...)
+//	name EXISTS, name MISSING
+//
+// The condition applies to the components of a composite index when the name is followed by the leading
+// components in parentheses, for example domain_owner("iov") = "dave" or domain_owner() > "iov".
+// Values are double quoted strings, with Go escape sequences, or 0x prefixed hexadecimal bytes.
+// The modifiers are:
+//
+//	RANGE start..end, RANGE start.. for a range without end
+//	ORDER BY name
+//	DESC
+//	FROM 0x... to resume from the key returned by crud.Cursor.NextKey
+//
+// Keywords are case insensitive, index names are not.
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+)
+
+// Registry maps the index names used in the queries to their index ids
+type Registry map[string]crud.IndexID
+
+// Error is an error found in a query text, it wraps crud.ErrBadArgument
+type Error struct {
+	// Pos is the byte offset of the offending token in the query text
+	Pos int
+	// Msg describes the error
+	Msg string
+}
+
+func newError(pos int, format string, args ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: position %d: %s", crud.ErrBadArgument, e.Pos, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return crud.ErrBadArgument
+}
+
+// Parse applies the query text to q, which must not have any condition yet, and returns the resulting query
+// the errors of the text are returned as *Error, the errors the query methods find, such as an inverted BETWEEN,
+// are returned when the query is run as usual.
+func Parse(q crud.QueryStatement, registry Registry, text string) (crud.ValidQuery, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, registry: registry}
+	return p.parse(q)
+}
+
+// parser reads the tokens of a query text
+type parser struct {
+	tokens   []token
+	i        int
+	registry Registry
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// next returns the current token and moves to the next one
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept moves to the next token if the current one is the given keyword or symbol
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// expect moves to the next token, which must be the given keyword or symbol
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.unexpected(s)
+	}
+	return nil
+}
+
+// unexpected returns the error of the current token, which is not the expected one
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	return newError(t.pos, "unexpected %s, expected %s", t, expected)
+}
+
+func (p *parser) parse(q crud.QueryStatement) (crud.ValidQuery, error) {
+	var query crud.ValidQuery = q
+	expected := "a condition or a modifier"
+	if p.peek().is("(") || (p.peek().kind == tokenWord && !p.isModifier()) {
+		finalized, err := p.parseConditions(q.Where())
+		if err != nil {
+			return nil, err
+		}
+		query = finalized
+		expected = "AND, OR or a modifier"
+	}
+	for p.peek().kind != tokenEOF {
+		if !p.isModifier() {
+			return nil, p.unexpected(expected)
+		}
+		expected = "a modifier"
+		var err error
+		query, err = p.parseModifier(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// isModifier checks if the current token starts a modifier
+func (p *parser) isModifier() bool {
+	t := p.peek()
+	return t.is("RANGE") || t.is("ORDER") || t.is("DESC") || t.is("FROM")
+}
+
+// parseConditions parses the conditions joined by AND, AND NOT and OR
+func (p *parser) parseConditions(where crud.WhereStatement) (crud.FinalizedIndexStatement, error) {
+	for {
+		finalized, err := p.parseCondition(where)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case p.accept("AND"):
+			if p.accept("NOT") {
+				where = finalized.AndNot()
+			} else {
+				where = finalized.And()
+			}
+		case p.accept("OR"):
+			where = finalized.Or()
+		default:
+			return finalized, nil
+		}
+	}
+}
+
+// parseCondition parses a condition on an index, or conditions in parentheses
+func (p *parser) parseCondition(where crud.WhereStatement) (crud.FinalizedIndexStatement, error) {
+	if p.accept("(") {
+		var err error
+		finalized := where.Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+			var group crud.FinalizedIndexStatement
+			group, err = p.parseConditions(where)
+			return group
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return finalized, nil
+	}
+	id, err := p.parseIndexName()
+	if err != nil {
+		return nil, err
+	}
+	index := where.Index(id)
+	if p.accept("(") {
+		components, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		index = index.Components(components...)
+	}
+
+	op := p.next()
+	switch {
+	case op.is("="), op.is("!="), op.is(">"), op.is(">="), op.is("<"), op.is("<="), op.is("PREFIX"):
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return comparison(index, op.text, v), nil
+	case op.is("BETWEEN"):
+		lower, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return index.Between(lower, upper), nil
+	case op.is("IN"):
+		values, err := p.parseValues()
+		if err != nil {
+			return nil, err
+		}
+		return index.In(values...), nil
+	case op.is("CONTAINS"):
+		all := p.accept("ALL")
+		if !all && !p.accept("ANY") {
+			return nil, p.unexpected("ALL or ANY")
+		}
+		values, err := p.parseValues()
+		if err != nil {
+			return nil, err
+		}
+		if all {
+			return index.ContainsAll(values...), nil
+		}
+		return index.ContainsAny(values...), nil
+	case op.is("EXISTS"):
+		return index.Exists(), nil
+	case op.is("MISSING"):
+		return index.Missing(), nil
+	}
+	return nil, newError(op.pos, "unexpected %s, expected an operator", op)
+}
+
+// comparison applies the comparison operator, or PREFIX, to the index
+func comparison(index crud.IndexStatement, op string, v []byte) crud.FinalizedIndexStatement {
+	switch op {
+	case "=":
+		return index.Equals(v)
+	case "!=":
+		return index.NotEquals(v)
+	case ">":
+		return index.GreaterThan(v)
+	case ">=":
+		return index.GreaterOrEqual(v)
+	case "<":
+		return index.LessThan(v)
+	case "<=":
+		return index.LessOrEqual(v)
+	default:
+		return index.HasPrefix(v)
+	}
+}
+
+// parseIndexName parses an index name and returns its id
+func (p *parser) parseIndexName() (crud.IndexID, error) {
+	name := p.next()
+	if name.kind != tokenWord {
+		return 0, newError(name.pos, "unexpected %s, expected an index name", name)
+	}
+	id, ok := p.registry[name.text]
+	if !ok {
+		return 0, newError(name.pos, "unknown index %s", name)
+	}
+	return id, nil
+}
+
+// parseValues parses a non empty list of values in parentheses
+func (p *parser) parseValues() ([][]byte, error) {
+	open := p.peek()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	values, err := p.parseValueList()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, newError(open.pos, "empty list of values")
+	}
+	return values, nil
+}
+
+// parseValueList parses a possibly empty list of values up to the closing parenthesis, the opening one being read
+func (p *parser) parseValueList() ([][]byte, error) {
+	values := make([][]byte, 0)
+	if p.accept(")") {
+		return values, nil
+	}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.accept(")") {
+			return values, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseValue parses a string or hexadecimal value
+func (p *parser) parseValue() ([]byte, error) {
+	t := p.next()
+	if t.kind != tokenString && t.kind != tokenHex {
+		return nil, newError(t.pos, "unexpected %s, expected a value", t)
+	}
+	return t.value, nil
+}
+
+// parseNumber parses a decimal number
+func (p *parser) parseNumber() (uint64, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, newError(t.pos, "unexpected %s, expected a number", t)
+	}
+	n, err := strconv.ParseUint(t.text, 10, 64)
+	if err != nil {
+		return 0, newError(t.pos, "invalid number %s: %s", t, err)
+	}
+	return n, nil
+}
+
+// parseModifier parses a modifier and applies it to the query
+func (p *parser) parseModifier(q crud.ValidQuery) (crud.ValidQuery, error) {
+	t := p.next()
+	switch {
+	case t.is("RANGE"):
+		start, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(".."); err != nil {
+			return nil, err
+		}
+		var end uint64
+		if p.peek().kind == tokenNumber {
+			if end, err = p.parseNumber(); err != nil {
+				return nil, err
+			}
+		}
+		return q.WithRange().Start(start).End(end), nil
+	case t.is("ORDER"):
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		id, err := p.parseIndexName()
+		if err != nil {
+			return nil, err
+		}
+		return q.OrderBy(id), nil
+	case t.is("DESC"):
+		return q.Descending(), nil
+	case t.is("FROM"):
+		key := p.next()
+		if key.kind != tokenHex {
+			return nil, newError(key.pos, "unexpected %s, expected a hexadecimal key", key)
+		}
+		return q.ResumeFrom(key.value), nil
+	}
+	return nil, newError(t.pos, "unexpected %s, expected a modifier", t)
+}
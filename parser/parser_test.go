@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/test"
+	"github.com/iov-one/cosmos-sdk-crud/types"
+)
+
+func TestParse(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := types.NewStore(cdc, db, nil)
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+	registry := Registry{"a": test.IndexID_A, "b": test.IndexID_B}
+
+	cases := map[string]struct {
+		text     string
+		expected crud.ValidQuery
+	}{
+		"empty": {
+			text:     "",
+			expected: s.Query(),
+		},
+		"comparisons": {
+			text: `a = "a1" AND b > "b1" AND b >= "b2" AND b < "b9" AND b <= "b8" AND b != "b4"`,
+			expected: s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).
+				And().Index(test.IndexID_B).GreaterThan([]byte("b1")).
+				And().Index(test.IndexID_B).GreaterOrEqual([]byte("b2")).
+				And().Index(test.IndexID_B).LessThan([]byte("b9")).
+				And().Index(test.IndexID_B).LessOrEqual([]byte("b8")).
+				And().Index(test.IndexID_B).NotEquals([]byte("b4")),
+		},
+		"and not, or": {
+			text: `a IN ("a0", "a2") and not b BETWEEN "b2" AND "b6" OR b PREFIX "b4"`,
+			expected: s.Query().Where().Index(test.IndexID_A).In([]byte("a0"), []byte("a2")).
+				AndNot().Index(test.IndexID_B).Between([]byte("b2"), []byte("b6")).
+				Or().Index(test.IndexID_B).HasPrefix([]byte("b4")),
+		},
+		"hexadecimal and escaped values": {
+			text:     `a = 0x6131 OR b = "\x623"`,
+			expected: s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).Or().Index(test.IndexID_B).Equals([]byte("b3")),
+		},
+		"exists and contains": {
+			text: `a EXISTS AND b MISSING OR a CONTAINS ALL ("a1") AND b CONTAINS ANY ("b1", "b4")`,
+			expected: s.Query().Where().Index(test.IndexID_A).Exists().And().Index(test.IndexID_B).Missing().
+				Or().Index(test.IndexID_A).ContainsAll([]byte("a1")).And().Index(test.IndexID_B).ContainsAny([]byte("b1"), []byte("b4")),
+		},
+		"groups": {
+			text: `b < "b8" AND (a = "a0" OR a = "a1" AND b > "b3") AND NOT (b = "b0" OR b = "b1")`,
+			expected: s.Query().Where().Index(test.IndexID_B).LessThan([]byte("b8")).
+				And().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+				return where.Index(test.IndexID_A).Equals([]byte("a0")).
+					Or().Index(test.IndexID_A).Equals([]byte("a1")).And().Index(test.IndexID_B).GreaterThan([]byte("b3"))
+			}).
+				AndNot().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+				return where.Index(test.IndexID_B).Equals([]byte("b0")).Or().Index(test.IndexID_B).Equals([]byte("b1"))
+			}),
+		},
+		"modifiers": {
+			text:     `b >= "b1" RANGE 1..4 ORDER BY a DESC`,
+			expected: s.Query().Where().Index(test.IndexID_B).GreaterOrEqual([]byte("b1")).WithRange().Start(1).End(4).OrderBy(test.IndexID_A).Descending(),
+		},
+		"modifiers only": {
+			text:     `desc range 2..`,
+			expected: s.Query().Descending().WithRange().Start(2).End(0),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			q, err := Parse(s.Query(), registry, c.text)
+			test.CheckNoError(t, err)
+			if actual, expected := test.QueryKeys(t, q), test.QueryKeys(t, c.expected); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+			}
+		})
+	}
+	t.Run("resume from", func(t *testing.T) {
+		crs, err := s.Query().Do()
+		test.CheckNoError(t, err)
+		crs.Next()
+		q, err := Parse(s.Query(), registry, "FROM 0x"+hex.EncodeToString(crs.NextKey()))
+		test.CheckNoError(t, err)
+		if actual, expected := test.QueryKeys(t, q), test.QueryKeys(t, s.Query().ResumeFrom(crs.NextKey())); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+		}
+	})
+
+	errorCases := map[string]struct {
+		text string
+		pos  int
+	}{
+		"unknown index":          {text: `a = "a1" AND c = "c1"`, pos: 13},
+		"missing value":          {text: `a = AND`, pos: 4},
+		"missing operator":       {text: `a "a1"`, pos: 2},
+		"unterminated string":    {text: `a = "a1`, pos: 4},
+		"invalid hexadecimal":    {text: `a = 0x6`, pos: 4},
+		"unexpected character":   {text: `a = "a1" & b = "b1"`, pos: 9},
+		"missing conjunction":    {text: `a = "a1" b = "b1"`, pos: 9},
+		"empty list":             {text: `a IN ()`, pos: 5},
+		"unclosed group":         {text: `(a = "a1" OR b = "b1"`, pos: 21},
+		"empty group":            {text: `a = "a1" AND ()`, pos: 14},
+		"unclosed list":          {text: `a IN ("a1", "a2"`, pos: 16},
+		"contains without all":   {text: `a CONTAINS ("a1")`, pos: 11},
+		"between without and":    {text: `a BETWEEN "a1" OR "a2"`, pos: 15},
+		"range without end mark": {text: `RANGE 1 2`, pos: 8},
+		"number overflow":        {text: `RANGE 99999999999999999999..`, pos: 6},
+		"condition after range":  {text: `RANGE 1..2 a = "a1"`, pos: 11},
+		"order by unknown index": {text: `ORDER BY c`, pos: 9},
+		"from without key":       {text: `FROM "a"`, pos: 5},
+	}
+	for name, c := range errorCases {
+		t.Run("bad argument/"+name, func(t *testing.T) {
+			_, err := Parse(s.Query(), registry, c.text)
+			if !errors.Is(err, crud.ErrBadArgument) {
+				t.Fatal("unexpected error", err)
+			}
+			var parseErr *Error
+			if !errors.As(err, &parseErr) || parseErr.Pos != c.pos {
+				t.Fatalf("unexpected error position (expected : %d, actual : %v)", c.pos, err)
+			}
+		})
+	}
+	t.Run("bad argument/inverted between", func(t *testing.T) {
+		// the errors of the query methods are returned when the query is run
+		q, err := Parse(s.Query(), registry, `a BETWEEN "b" AND "a"`)
+		test.CheckNoError(t, err)
+		if _, err := q.Do(); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
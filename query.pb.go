@@ -0,0 +1,1373 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: query.proto
+
+package crud
+
+import (
+	fmt "fmt"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+// Operator defines how a clause compares the values of an index
+// values are compared byte-wise
+type Operator int32
+
+const (
+	// OPERATOR_UNSPECIFIED is not a valid operator
+	Operator_OPERATOR_UNSPECIFIED Operator = 0
+	// OPERATOR_EQUAL matches the values equal to the only value of the clause
+	Operator_OPERATOR_EQUAL Operator = 1
+	// OPERATOR_GREATER_THAN matches the values strictly greater than the only value of the clause
+	Operator_OPERATOR_GREATER_THAN Operator = 2
+	// OPERATOR_GREATER_OR_EQUAL matches the values greater than or equal to the only value of the clause
+	Operator_OPERATOR_GREATER_OR_EQUAL Operator = 3
+	// OPERATOR_LESS_THAN matches the values strictly less than the only value of the clause
+	Operator_OPERATOR_LESS_THAN Operator = 4
+	// OPERATOR_LESS_OR_EQUAL matches the values less than or equal to the only value of the clause
+	Operator_OPERATOR_LESS_OR_EQUAL Operator = 5
+	// OPERATOR_BETWEEN matches the values in the interval [values[0], values[1]]
+	Operator_OPERATOR_BETWEEN Operator = 6
+	// OPERATOR_PREFIX matches the values starting with the only value of the clause
+	Operator_OPERATOR_PREFIX Operator = 7
+	// OPERATOR_IN matches the values equal to any of the values of the clause
+	Operator_OPERATOR_IN Operator = 8
+	// OPERATOR_EXISTS matches any value, it selects the objects having a value for the index and takes no value
+	Operator_OPERATOR_EXISTS Operator = 9
+)
+
+var Operator_name = map[int32]string{
+	0: "OPERATOR_UNSPECIFIED",
+	1: "OPERATOR_EQUAL",
+	2: "OPERATOR_GREATER_THAN",
+	3: "OPERATOR_GREATER_OR_EQUAL",
+	4: "OPERATOR_LESS_THAN",
+	5: "OPERATOR_LESS_OR_EQUAL",
+	6: "OPERATOR_BETWEEN",
+	7: "OPERATOR_PREFIX",
+	8: "OPERATOR_IN",
+	9: "OPERATOR_EXISTS",
+}
+
+var Operator_value = map[string]int32{
+	"OPERATOR_UNSPECIFIED":      0,
+	"OPERATOR_EQUAL":            1,
+	"OPERATOR_GREATER_THAN":     2,
+	"OPERATOR_GREATER_OR_EQUAL": 3,
+	"OPERATOR_LESS_THAN":        4,
+	"OPERATOR_LESS_OR_EQUAL":    5,
+	"OPERATOR_BETWEEN":          6,
+	"OPERATOR_PREFIX":           7,
+	"OPERATOR_IN":               8,
+	"OPERATOR_EXISTS":           9,
+}
+
+func (x Operator) String() string {
+	return proto.EnumName(Operator_name, int32(x))
+}
+
+func (Operator) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5c6ac9b241082464, []int{0}
+}
+
+// Clause is a condition on the values of an index
+type Clause struct {
+	// IndexId is the index the condition applies to, it must fit in a byte
+	IndexId uint32 `protobuf:"varint,1,opt,name=index_id,json=indexId,proto3" json:"index_id,omitempty"`
+	// Operator defines how the index values are compared to the values of the clause
+	Operator Operator `protobuf:"varint,2,opt,name=operator,proto3,enum=cosmosSdkCrud.v1beta1.Operator" json:"operator,omitempty"`
+	// Values are the operands of the operator
+	Values [][]byte `protobuf:"bytes,3,rep,name=values,proto3" json:"values,omitempty"`
+	// Negated selects the objects which do not match the condition instead of the ones which do
+	Negated bool `protobuf:"varint,4,opt,name=negated,proto3" json:"negated,omitempty"`
+	// Composite applies the condition to a component of the values of a composite index,
+	// whose leading components must be equal to Components
+	Composite bool `protobuf:"varint,5,opt,name=composite,proto3" json:"composite,omitempty"`
+	// Components are the leading components of the values of a composite index
+	Components [][]byte `protobuf:"bytes,6,rep,name=components,proto3" json:"components,omitempty"`
+}
+
+func (m *Clause) Reset()         { *m = Clause{} }
+func (m *Clause) String() string { return proto.CompactTextString(m) }
+func (*Clause) ProtoMessage()    {}
+func (*Clause) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5c6ac9b241082464, []int{0}
+}
+func (m *Clause) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Clause) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Clause.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Clause) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Clause.Merge(m, src)
+}
+func (m *Clause) XXX_Size() int {
+	return m.Size()
+}
+func (m *Clause) XXX_DiscardUnknown() {
+	xxx_messageInfo_Clause.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Clause proto.InternalMessageInfo
+
+func (m *Clause) GetIndexId() uint32 {
+	if m != nil {
+		return m.IndexId
+	}
+	return 0
+}
+
+func (m *Clause) GetOperator() Operator {
+	if m != nil {
+		return m.Operator
+	}
+	return Operator_OPERATOR_UNSPECIFIED
+}
+
+func (m *Clause) GetValues() [][]byte {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
+func (m *Clause) GetNegated() bool {
+	if m != nil {
+		return m.Negated
+	}
+	return false
+}
+
+func (m *Clause) GetComposite() bool {
+	if m != nil {
+		return m.Composite
+	}
+	return false
+}
+
+func (m *Clause) GetComponents() [][]byte {
+	if m != nil {
+		return m.Components
+	}
+	return nil
+}
+
+// Conjunction is a group of clauses an object must all match
+type Conjunction struct {
+	// Clauses
+	Clauses []*Clause `protobuf:"bytes,1,rep,name=clauses,proto3" json:"clauses,omitempty"`
+}
+
+func (m *Conjunction) Reset()         { *m = Conjunction{} }
+func (m *Conjunction) String() string { return proto.CompactTextString(m) }
+func (*Conjunction) ProtoMessage()    {}
+func (*Conjunction) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5c6ac9b241082464, []int{1}
+}
+func (m *Conjunction) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Conjunction) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Conjunction.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Conjunction) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Conjunction.Merge(m, src)
+}
+func (m *Conjunction) XXX_Size() int {
+	return m.Size()
+}
+func (m *Conjunction) XXX_DiscardUnknown() {
+	xxx_messageInfo_Conjunction.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Conjunction proto.InternalMessageInfo
+
+func (m *Conjunction) GetClauses() []*Clause {
+	if m != nil {
+		return m.Clauses
+	}
+	return nil
+}
+
+// OrderBy orders the results by the values of an index instead of their primary keys
+type OrderBy struct {
+	// IndexId is the index whose values order the results, it must fit in a byte
+	IndexId uint32 `protobuf:"varint,1,opt,name=index_id,json=indexId,proto3" json:"index_id,omitempty"`
+}
+
+func (m *OrderBy) Reset()         { *m = OrderBy{} }
+func (m *OrderBy) String() string { return proto.CompactTextString(m) }
+func (*OrderBy) ProtoMessage()    {}
+func (*OrderBy) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5c6ac9b241082464, []int{2}
+}
+func (m *OrderBy) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *OrderBy) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_OrderBy.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *OrderBy) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OrderBy.Merge(m, src)
+}
+func (m *OrderBy) XXX_Size() int {
+	return m.Size()
+}
+func (m *OrderBy) XXX_DiscardUnknown() {
+	xxx_messageInfo_OrderBy.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OrderBy proto.InternalMessageInfo
+
+func (m *OrderBy) GetIndexId() uint32 {
+	if m != nil {
+		return m.IndexId
+	}
+	return 0
+}
+
+// Query describes a query of the objects of a store, as built by the crud.QueryStatement methods
+type Query struct {
+	// Conjunctions are the groups of clauses of the query, an object is selected if it matches
+	// all the clauses of at least one of them, all the objects are selected if there is none
+	Conjunctions []*Conjunction `protobuf:"bytes,1,rep,name=conjunctions,proto3" json:"conjunctions,omitempty"`
+	// Start is the first result returned
+	Start uint64 `protobuf:"varint,2,opt,name=start,proto3" json:"start,omitempty"`
+	// End is the result after the last one returned, 0 means there is no end
+	End uint64 `protobuf:"varint,3,opt,name=end,proto3" json:"end,omitempty"`
+	// Descending returns the results in descending order
+	Descending bool `protobuf:"varint,4,opt,name=descending,proto3" json:"descending,omitempty"`
+	// OrderBy, if set, orders the results by the values of an index
+	OrderBy *OrderBy `protobuf:"bytes,5,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	// ResumeFrom is the key returned by Cursor.NextKey from which the same query resumes, empty to start from the first result
+	ResumeFrom []byte `protobuf:"bytes,6,opt,name=resume_from,json=resumeFrom,proto3" json:"resume_from,omitempty"`
+}
+
+func (m *Query) Reset()         { *m = Query{} }
+func (m *Query) String() string { return proto.CompactTextString(m) }
+func (*Query) ProtoMessage()    {}
+func (*Query) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5c6ac9b241082464, []int{3}
+}
+func (m *Query) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Query) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Query.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Query) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Query.Merge(m, src)
+}
+func (m *Query) XXX_Size() int {
+	return m.Size()
+}
+func (m *Query) XXX_DiscardUnknown() {
+	xxx_messageInfo_Query.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Query proto.InternalMessageInfo
+
+func (m *Query) GetConjunctions() []*Conjunction {
+	if m != nil {
+		return m.Conjunctions
+	}
+	return nil
+}
+
+func (m *Query) GetStart() uint64 {
+	if m != nil {
+		return m.Start
+	}
+	return 0
+}
+
+func (m *Query) GetEnd() uint64 {
+	if m != nil {
+		return m.End
+	}
+	return 0
+}
+
+func (m *Query) GetDescending() bool {
+	if m != nil {
+		return m.Descending
+	}
+	return false
+}
+
+func (m *Query) GetOrderBy() *OrderBy {
+	if m != nil {
+		return m.OrderBy
+	}
+	return nil
+}
+
+func (m *Query) GetResumeFrom() []byte {
+	if m != nil {
+		return m.ResumeFrom
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("cosmosSdkCrud.v1beta1.Operator", Operator_name, Operator_value)
+	proto.RegisterType((*Clause)(nil), "cosmosSdkCrud.v1beta1.Clause")
+	proto.RegisterType((*Conjunction)(nil), "cosmosSdkCrud.v1beta1.Conjunction")
+	proto.RegisterType((*OrderBy)(nil), "cosmosSdkCrud.v1beta1.OrderBy")
+	proto.RegisterType((*Query)(nil), "cosmosSdkCrud.v1beta1.Query")
+}
+
+func init() { proto.RegisterFile("query.proto", fileDescriptor_5c6ac9b241082464) }
+
+var fileDescriptor_5c6ac9b241082464 = []byte{
+	// 549 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0xc1, 0x4e, 0xdb, 0x40,
+	0x10, 0xcd, 0x62, 0x62, 0x9b, 0x31, 0x05, 0x6b, 0x0b, 0xc8, 0x54, 0xc5, 0x58, 0x51, 0xa5, 0x46,
+	0x95, 0x08, 0x82, 0x1e, 0xaa, 0x8a, 0x53, 0x48, 0x37, 0xad, 0x25, 0x94, 0xc0, 0x3a, 0xa8, 0xa8,
+	0x97, 0xc8, 0xf1, 0x6e, 0xa9, 0x0b, 0xf6, 0xd2, 0xb5, 0x8d, 0xca, 0x5f, 0xf4, 0xb3, 0x7a, 0xe4,
+	0xd8, 0x63, 0x05, 0x9f, 0xd0, 0x43, 0xaf, 0x95, 0xed, 0xc4, 0x21, 0x6a, 0xd3, 0x8b, 0xe5, 0xf7,
+	0xde, 0xbc, 0x9d, 0x9d, 0x37, 0x5a, 0x30, 0xbe, 0x64, 0x5c, 0xde, 0xb4, 0xae, 0xa4, 0x48, 0x05,
+	0x5e, 0x0f, 0x44, 0x12, 0x89, 0xc4, 0x63, 0x17, 0x1d, 0x99, 0xb1, 0xd6, 0xf5, 0xde, 0x88, 0xa7,
+	0xfe, 0x5e, 0xe3, 0x16, 0x81, 0xda, 0xb9, 0xf4, 0xb3, 0x84, 0xe3, 0x4d, 0xd0, 0xc3, 0x98, 0xf1,
+	0xaf, 0xc3, 0x90, 0x59, 0xc8, 0x41, 0xcd, 0x47, 0x54, 0x2b, 0xb0, 0xcb, 0xf0, 0x01, 0xe8, 0xe2,
+	0x8a, 0x4b, 0x3f, 0x15, 0xd2, 0x5a, 0x70, 0x50, 0x73, 0x65, 0x7f, 0xbb, 0xf5, 0xcf, 0xf3, 0x5a,
+	0xfd, 0x71, 0x19, 0xad, 0x0c, 0x78, 0x03, 0xd4, 0x6b, 0xff, 0x32, 0xe3, 0x89, 0xa5, 0x38, 0x4a,
+	0x73, 0x99, 0x8e, 0x11, 0xb6, 0x40, 0x8b, 0xf9, 0xb9, 0x9f, 0x72, 0x66, 0x2d, 0x3a, 0xa8, 0xa9,
+	0xd3, 0x09, 0xc4, 0x4f, 0x61, 0x29, 0x10, 0xd1, 0x95, 0x48, 0xc2, 0x94, 0x5b, 0xf5, 0x42, 0x9b,
+	0x12, 0xd8, 0x06, 0x28, 0x40, 0xcc, 0xe3, 0x34, 0xb1, 0xd4, 0xe2, 0xcc, 0x07, 0x4c, 0xa3, 0x0b,
+	0x46, 0x47, 0xc4, 0x9f, 0xb3, 0x38, 0x48, 0x43, 0x11, 0xe3, 0x57, 0xa0, 0x05, 0xc5, 0x80, 0x89,
+	0x85, 0x1c, 0xa5, 0x69, 0xec, 0x6f, 0xcd, 0xb9, 0x7a, 0x19, 0x03, 0x9d, 0x54, 0x37, 0x9e, 0x81,
+	0xd6, 0x97, 0x8c, 0xcb, 0xc3, 0x9b, 0xff, 0x44, 0xd3, 0xf8, 0x85, 0xa0, 0x7e, 0x92, 0xe7, 0x8c,
+	0xbb, 0xb0, 0x1c, 0x4c, 0xfb, 0x4e, 0xba, 0x35, 0xe6, 0x75, 0x9b, 0x96, 0xd2, 0x19, 0x1f, 0x5e,
+	0x83, 0x7a, 0x92, 0xfa, 0x32, 0x2d, 0x92, 0x5e, 0xa4, 0x25, 0xc0, 0x26, 0x28, 0x3c, 0x66, 0x96,
+	0x52, 0x70, 0xf9, 0x6f, 0x9e, 0x03, 0xe3, 0x49, 0xc0, 0x63, 0x16, 0xc6, 0xe7, 0xe3, 0x08, 0x1f,
+	0x30, 0xf8, 0x35, 0xe8, 0x22, 0xbf, 0xff, 0x70, 0x74, 0x53, 0x84, 0x68, 0xec, 0xdb, 0xf3, 0x96,
+	0x56, 0x8e, 0x49, 0x35, 0x31, 0x9e, 0x77, 0x1b, 0x0c, 0xc9, 0x93, 0x2c, 0xe2, 0xc3, 0x8f, 0x52,
+	0x44, 0x96, 0xea, 0xa0, 0x3c, 0xe3, 0x92, 0xea, 0x4a, 0x11, 0xbd, 0xf8, 0x8d, 0x40, 0x9f, 0xac,
+	0x1a, 0x5b, 0xb0, 0xd6, 0x3f, 0x26, 0xb4, 0x3d, 0xe8, 0xd3, 0xe1, 0x69, 0xcf, 0x3b, 0x26, 0x1d,
+	0xb7, 0xeb, 0x92, 0x37, 0x66, 0x0d, 0x63, 0x58, 0xa9, 0x14, 0x72, 0x72, 0xda, 0x3e, 0x32, 0x11,
+	0xde, 0x84, 0xf5, 0x8a, 0x7b, 0x4b, 0x49, 0x7b, 0x40, 0xe8, 0x70, 0xf0, 0xae, 0xdd, 0x33, 0x17,
+	0xf0, 0x16, 0x6c, 0xfe, 0x25, 0x55, 0x4e, 0x05, 0x6f, 0x00, 0xae, 0xe4, 0x23, 0xe2, 0x79, 0xa5,
+	0x6d, 0x11, 0x3f, 0x81, 0x8d, 0x59, 0xbe, 0xf2, 0xd4, 0xf1, 0x1a, 0x98, 0x95, 0x76, 0x48, 0x06,
+	0xef, 0x09, 0xe9, 0x99, 0x2a, 0x7e, 0x0c, 0xab, 0x15, 0x7b, 0x4c, 0x49, 0xd7, 0x3d, 0x33, 0x35,
+	0xbc, 0x0a, 0x46, 0x45, 0xba, 0x3d, 0x53, 0x9f, 0xa9, 0x22, 0x67, 0xae, 0x37, 0xf0, 0xcc, 0xa5,
+	0xc3, 0xf6, 0xf7, 0x3b, 0x1b, 0xdd, 0xde, 0xd9, 0xe8, 0xe7, 0x9d, 0x8d, 0xbe, 0xdd, 0xdb, 0xb5,
+	0xdb, 0x7b, 0xbb, 0xf6, 0xe3, 0xde, 0xae, 0x7d, 0x78, 0x7e, 0x1e, 0xa6, 0x9f, 0xb2, 0x51, 0x2b,
+	0x10, 0xd1, 0x6e, 0x28, 0xae, 0x77, 0x44, 0xcc, 0x77, 0xcb, 0xbc, 0x77, 0x12, 0x76, 0xb1, 0x13,
+	0xc8, 0x8c, 0x1d, 0xe4, 0x9f, 0x91, 0x5a, 0xbc, 0xc8, 0x97, 0x7f, 0x06, 0x00, 0xae, 0x13, 0x67,
+	0x17, 0xa0, 0x03, 0x00, 0x00,
+}
+
+func (m *Clause) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Clause) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Clause) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Components) > 0 {
+		for iNdEx := len(m.Components) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Components[iNdEx])
+			copy(dAtA[i:], m.Components[iNdEx])
+			i = encodeVarintQuery(dAtA, i, uint64(len(m.Components[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if m.Composite {
+		i--
+		if m.Composite {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.Negated {
+		i--
+		if m.Negated {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x20
+	}
+	if len(m.Values) > 0 {
+		for iNdEx := len(m.Values) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Values[iNdEx])
+			copy(dAtA[i:], m.Values[iNdEx])
+			i = encodeVarintQuery(dAtA, i, uint64(len(m.Values[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.Operator != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.Operator))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.IndexId != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.IndexId))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Conjunction) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Conjunction) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Conjunction) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Clauses) > 0 {
+		for iNdEx := len(m.Clauses) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Clauses[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintQuery(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *OrderBy) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *OrderBy) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *OrderBy) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.IndexId != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.IndexId))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Query) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Query) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Query) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.ResumeFrom) > 0 {
+		i -= len(m.ResumeFrom)
+		copy(dAtA[i:], m.ResumeFrom)
+		i = encodeVarintQuery(dAtA, i, uint64(len(m.ResumeFrom)))
+		i--
+		dAtA[i] = 0x32
+	}
+	if m.OrderBy != nil {
+		{
+			size, err := m.OrderBy.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintQuery(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x2a
+	}
+	if m.Descending {
+		i--
+		if m.Descending {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.End != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.End))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.Start != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.Start))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Conjunctions) > 0 {
+		for iNdEx := len(m.Conjunctions) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Conjunctions[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintQuery(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintQuery(dAtA []byte, offset int, v uint64) int {
+	offset -= sovQuery(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *Clause) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.IndexId != 0 {
+		n += 1 + sovQuery(uint64(m.IndexId))
+	}
+	if m.Operator != 0 {
+		n += 1 + sovQuery(uint64(m.Operator))
+	}
+	if len(m.Values) > 0 {
+		for _, b := range m.Values {
+			l = len(b)
+			n += 1 + l + sovQuery(uint64(l))
+		}
+	}
+	if m.Negated {
+		n += 2
+	}
+	if m.Composite {
+		n += 2
+	}
+	if len(m.Components) > 0 {
+		for _, b := range m.Components {
+			l = len(b)
+			n += 1 + l + sovQuery(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *Conjunction) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Clauses) > 0 {
+		for _, e := range m.Clauses {
+			l = e.Size()
+			n += 1 + l + sovQuery(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *OrderBy) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.IndexId != 0 {
+		n += 1 + sovQuery(uint64(m.IndexId))
+	}
+	return n
+}
+
+func (m *Query) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Conjunctions) > 0 {
+		for _, e := range m.Conjunctions {
+			l = e.Size()
+			n += 1 + l + sovQuery(uint64(l))
+		}
+	}
+	if m.Start != 0 {
+		n += 1 + sovQuery(uint64(m.Start))
+	}
+	if m.End != 0 {
+		n += 1 + sovQuery(uint64(m.End))
+	}
+	if m.Descending {
+		n += 2
+	}
+	if m.OrderBy != nil {
+		l = m.OrderBy.Size()
+		n += 1 + l + sovQuery(uint64(l))
+	}
+	l = len(m.ResumeFrom)
+	if l > 0 {
+		n += 1 + l + sovQuery(uint64(l))
+	}
+	return n
+}
+
+func sovQuery(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozQuery(x uint64) (n int) {
+	return sovQuery(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *Clause) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Clause: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Clause: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IndexId", wireType)
+			}
+			m.IndexId = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.IndexId |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Operator", wireType)
+			}
+			m.Operator = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Operator |= Operator(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Values", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Values = append(m.Values, make([]byte, postIndex-iNdEx))
+			copy(m.Values[len(m.Values)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Negated", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Negated = bool(v != 0)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Composite", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Composite = bool(v != 0)
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Components", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Components = append(m.Components, make([]byte, postIndex-iNdEx))
+			copy(m.Components[len(m.Components)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQuery(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Conjunction) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Conjunction: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Conjunction: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Clauses", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Clauses = append(m.Clauses, &Clause{})
+			if err := m.Clauses[len(m.Clauses)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQuery(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *OrderBy) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: OrderBy: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: OrderBy: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IndexId", wireType)
+			}
+			m.IndexId = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.IndexId |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQuery(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Query) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Query: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Query: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Conjunctions", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Conjunctions = append(m.Conjunctions, &Conjunction{})
+			if err := m.Conjunctions[len(m.Conjunctions)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			m.Start = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Start |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field End", wireType)
+			}
+			m.End = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.End |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Descending", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Descending = bool(v != 0)
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field OrderBy", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.OrderBy == nil {
+				m.OrderBy = &OrderBy{}
+			}
+			if err := m.OrderBy.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResumeFrom", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ResumeFrom = append(m.ResumeFrom[:0], dAtA[iNdEx:postIndex]...)
+			if m.ResumeFrom == nil {
+				m.ResumeFrom = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQuery(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipQuery(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthQuery
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupQuery
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthQuery
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthQuery        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowQuery          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupQuery = fmt.Errorf("proto: unexpected end of group")
+)
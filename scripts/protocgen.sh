@@ -18,4 +18,5 @@ protoc \
   --grpc-gateway_opt paths=Mgoogle/protobuf/any.proto=github.com/cosmos/cosmos-sdk/codec/types,Mgoogle/protobuf/empty.proto=github.com/gogo/protobuf/types,paths=source_relative \
   --doc_out=./doc \
   --doc_opt=markdown,crud.md \
+  query.proto \
   $(find "${PROJECT_PROTO_DIR}" -maxdepth 1 -name '*.proto')
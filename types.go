@@ -35,25 +35,97 @@ type Object interface {
 	PrimaryKey() []byte
 	// SecondaryKeys is an array containing the secondary keys
 	// used to map the object
+	// several keys can have the same ID, for example one per tag of the object: such a multi-valued
+	// index is queried with ContainsAll and ContainsAny, and a value returned twice is indexed once
 	SecondaryKeys() []SecondaryKey
 }
 
 type ValidQuery interface {
 	WithRange() RangeStatement
+	// Descending makes the query return objects in descending primary key order
+	// the range, if any, applies to the results in that order
+	Descending() ValidQuery
+	// OrderBy makes the query return objects in the order of their values for the given index
+	// instead of primary key order, objects without any value for the index are not returned.
+	// If every group of clauses has an Equals or an In, and these select few objects, only these objects are read,
+	// otherwise every object having a value for the index is read to check the clauses.
+	OrderBy(id IndexID) ValidQuery
+	// ResumeFrom makes the query return objects from the one identified by nextKey included
+	// nextKey must have been returned by Cursor.NextKey for the same query, the range, if any, is relative to it
+	ResumeFrom(nextKey []byte) ValidQuery
 	Do() (Cursor, error)
+	// Count returns the number of objects Do would return, without reading them
+	Count() (uint64, error)
+	// One reads to o the only object the query returns
+	// it returns ErrNotFound if there is none and ErrMultipleResults if there are several of them
+	One(o Object) error
+	// MustOne is One, it panics if One returns an error
+	MustOne(o Object)
+	// First reads to o the first object the query returns, in the query order
+	// it returns ErrNotFound if there is none
+	First(o Object) error
+	// IndexValues returns a cursor over the distinct values of the given index, in ascending order or in descending order
+	// if the query is Descending, along with the number of objects having each of them. The range and ResumeFrom of the query
+	// apply to the values, the query cannot have any clause, order or filter as the values are read from the index counters,
+	// without visiting the objects. ResumeFrom takes the keys returned by IndexValueCursor.NextKey.
+	IndexValues(id IndexID) (IndexValueCursor, error)
 }
 
 type QueryStatement interface {
 	ValidQuery
 	Where() WhereStatement
+	// GetUnique reads to o the object whose value for the given unique index is value
+	// it returns ErrNotFound if there is none, and ErrBadArgument if the index was not declared unique
+	GetUnique(id IndexID, value []byte, o Object) error
 }
 
 type WhereStatement interface {
 	Index(id IndexID) IndexStatement
+	// Group selects the objects matching the clauses fn adds to where, which it must return,
+	// so that they bind as a whole: D.And().Group(A.Or().B) means D and (A or B).
+	// The clauses cannot set a range, an order, a resume key or filters, which apply to the whole query.
+	// A negated group, after AndNot, can only hold single clauses joined by Or.
+	Group(fn func(where WhereStatement) FinalizedIndexStatement) FinalizedIndexStatement
 }
 
+// IndexStatement defines the conditions which can be applied to the values of an index
+// values are compared byte-wise, as bytes.Compare does.
+// The conditions selecting an interval of values, which are the comparisons, Between, HasPrefix, Exists and the conditions
+// on the components of a composite index, read the first object of every distinct value of the interval before returning
+// the first object in primary key order: their cost grows with the number of distinct values of the interval,
+// whatever the range of the query, while Equals and In only read the objects of their values.
 type IndexStatement interface {
+	// Components applies the next condition to the values of a composite index built by CompositeKey:
+	// their leading components must be equal to the given ones, and the condition applies to the component after them,
+	// for example Components(domain).HasPrefix(owner) selects the objects of the given domain whose owner starts with owner
+	// and Components().Equals(domain) the objects of the given domain, whatever their other components are.
+	Components(leading ...[]byte) IndexStatement
 	Equals(v []byte) FinalizedIndexStatement
+	// NotEquals selects the objects which do not have v as index value
+	// objects without any value for the index are selected too
+	NotEquals(v []byte) FinalizedIndexStatement
+	// GreaterThan selects the objects whose index value is strictly greater than v
+	GreaterThan(v []byte) FinalizedIndexStatement
+	// GreaterOrEqual selects the objects whose index value is greater than or equal to v
+	GreaterOrEqual(v []byte) FinalizedIndexStatement
+	// LessThan selects the objects whose index value is strictly less than v
+	LessThan(v []byte) FinalizedIndexStatement
+	// LessOrEqual selects the objects whose index value is less than or equal to v
+	LessOrEqual(v []byte) FinalizedIndexStatement
+	// Between selects the objects whose index value is in the interval [lower, upper]
+	Between(lower, upper []byte) FinalizedIndexStatement
+	// HasPrefix selects the objects whose index value starts with p
+	HasPrefix(p []byte) FinalizedIndexStatement
+	// In selects the objects whose index value is equal to any of the given values
+	In(values ...[]byte) FinalizedIndexStatement
+	// Exists selects the objects having at least one value for the index
+	Exists() FinalizedIndexStatement
+	// Missing selects the objects which do not have any value for the index
+	Missing() FinalizedIndexStatement
+	// ContainsAll selects the objects having all the given values for a multi-valued index
+	ContainsAll(values ...[]byte) FinalizedIndexStatement
+	// ContainsAny selects the objects having at least one of the given values for a multi-valued index
+	ContainsAny(values ...[]byte) FinalizedIndexStatement
 }
 
 type RangeStatement interface {
@@ -67,6 +139,19 @@ type RangeEndStatement interface {
 type FinalizedIndexStatement interface {
 	ValidQuery
 	And() WhereStatement
+	// AndNot excludes the objects matching the next clause
+	AndNot() WhereStatement
+	// Or starts a new group of clauses, the query selects the objects matching all the clauses
+	// of at least one group: And binds tighter than Or, so A.And().B.Or().C means (A and B) or C,
+	// WhereStatement.Group allows A.And().Group(B.Or().C) for A and (B or C)
+	Or() WhereStatement
+	// Filter keeps, among the objects selected by the clauses, the ones for which pred returns true,
+	// for the conditions which cannot be answered by the indexes. The objects are decoded to the objects newObj returns
+	// before being given to pred, and the range of the query applies to the objects kept, so that pages stay full.
+	// As every object selected by the clauses is decoded, the clauses should select few objects.
+	// Each object is decoded once: Cursor.Read copies the decoded object to an object of the same type instead of decoding it again.
+	// The cursor stops if an object cannot be decoded to the object newObj returns, Cursor.Error returns the error.
+	Filter(newObj func() Object, pred func(Object) bool) ValidQuery
 }
 
 // Store defines the abstract interface of the crud store
@@ -85,13 +170,49 @@ type Store interface {
 	// fails if there are errors marshalling
 	// or if the object does not exist
 	Update(o Object) error
+	// Save creates the object, or updates it if it already exists,
+	// created tells if it was created; it fails as Create or Update would
+	Save(o Object) (created bool, err error)
+	// Modify reads the object identified by primaryKey to o, calls fn with it and updates the object fn modified
+	// nothing is written if fn returns an error, which is returned,
+	// it fails with ErrBadArgument if fn changed the primary key
+	Modify(primaryKey []byte, o Object, fn func(o Object) error) error
 	// Delete deletes the object from the crud store
 	// given the primary key, fails if the object with
 	// primary key provided does not exist
 	Delete(primaryKey []byte) error
+	// CreateMany creates the objects, either all of them or none
+	// the objects are checked before any of them is written, they cannot share a primary key,
+	// the error of the failing object is returned as a *BatchError naming it
+	CreateMany(objects []Object) error
+	// UpdateMany updates the objects, either all of them or none, as CreateMany does
+	UpdateMany(objects []Object) error
+	// DeleteMany deletes the objects with the given primary keys, either all of them or none, as CreateMany does
+	DeleteMany(primaryKeys [][]byte) error
 	// Query allows to use query statements to retrieve objects
 	// using their secondary keys
 	Query() QueryStatement
+	// QueryFrom runs the query described by q, as Query().Do() would for the same clauses
+	// it returns ErrBadArgument if the description is not a valid query
+	QueryFrom(q *Query) (Cursor, error)
+}
+
+// IndexValueCursor iterates over the distinct values of an index
+type IndexValueCursor interface {
+	// Value returns the current index value
+	Value() []byte
+	// Count returns the number of objects having the current index value
+	Count() uint64
+	// Next moves onto the next value
+	Next()
+	// Valid asserts if the cursor is fully consumed or not
+	Valid() bool
+	// Error returns the error which made the cursor stop before the last value, such as a counter of the store
+	// which cannot be decoded, it must be checked once the cursor is not valid anymore
+	Error() error
+	// NextKey returns an opaque key from which the same listing resumes at the current value
+	// using ValidQuery.ResumeFrom, it is nil if the cursor is fully consumed
+	NextKey() []byte
 }
 
 // Cursor defines an objects iterator returned after a query to the crud.Store
@@ -106,6 +227,12 @@ type Cursor interface {
 	Next()
 	// Valid asserts if the cursor is fully consumed or not
 	Valid() bool
+	// Error returns the error which made the cursor stop before the last object, such as an index of the store
+	// which cannot be read, it must be checked once the cursor is not valid anymore
+	Error() error
+	// NextKey returns an opaque key from which the same query resumes at the current object
+	// using ValidQuery.ResumeFrom, it is nil if the cursor is fully consumed
+	NextKey() []byte
 }
 
 func (s SecondaryKey) String() string {
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/cosmos/cosmos-sdk/store/prefix"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	crud "github.com/iov-one/cosmos-sdk-crud"
+)
+
+// RebuildIndexes drops the indexes, the counters and the ranks of the store and builds them again from its objects,
+// which are decoded to the objects newObject returns. The layout of the indexes changed since the first versions
+// of the store, whose indexes and counters cannot be read by this version: RebuildIndexes must be run once,
+// typically from an upgrade handler, on the stores they wrote, see doc/upgrade.md.
+// As the other mutations, it runs on a cache which is written only if it succeeds.
+func (s Store) RebuildIndexes(newObject func() crud.Object) error {
+	return s.atomic(func(s Store) error {
+		for _, p := range []byte{IndexesPrefix, MetadataPrefix, RanksPrefix} {
+			clearStore(prefix.NewStore(s.db, []byte{p}))
+		}
+		it, err := s.objects.GetAllKeysWithIterator(0, 0, false)
+		if err != nil {
+			return err
+		}
+		// the keys are collected as the store is written while they are read
+		primaryKeys := it.Collect()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		// the objects are indexed without ranks, which are built afterwards in a single pass over the keys
+		unranked := s
+		unranked.ranked = false
+		unranked = unranked.withDB(s.db)
+		for _, primaryKey := range primaryKeys {
+			o := newObject()
+			if err := s.objects.Read(primaryKey, o); err != nil {
+				return fmt.Errorf("%w: unable to decode object %x: %s", crud.ErrInternal, primaryKey, err)
+			}
+			if err := unranked.indexes.Index(o); err != nil {
+				return err
+			}
+			s.metadata.IncreaseObjectCount()
+		}
+		if err := s.objects.BuildRanks(); err != nil {
+			return err
+		}
+		return s.indexes.BuildRanks()
+	})
+}
+
+// clearStore deletes all the keys of the store
+func clearStore(db sdk.KVStore) {
+	it := db.Iterator(nil, nil)
+	var keys [][]byte
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	_ = it.Close()
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
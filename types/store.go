@@ -1,18 +1,24 @@
 package types
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 
 	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/store/cachekv"
 	"github.com/cosmos/cosmos-sdk/store/prefix"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
 	"github.com/iov-one/cosmos-sdk-crud/internal/query"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/indexes"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/iterator"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/metadata"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/objects"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/ranks"
 	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
+	"github.com/iov-one/cosmos-sdk-crud/internal/util"
 )
 
 // DefaultVerifyType asserts that the type is not verified when
@@ -31,32 +37,95 @@ const IndexesPrefix = 0x1
 // in which we are storing objects metadata
 const MetadataPrefix = 0x2
 
+// RanksPrefix defines the prefix of the kv store
+// in which we are storing the ranks of the primary keys
+const RanksPrefix = 0x3
+
 type Store struct {
 	cdc codec.Codec
 
 	verifyType bool
+	// ranked tells if the ranks of the primary keys are maintained
+	ranked bool
+	// uniqueIndexes are the indexes whose values can only point to a single object
+	uniqueIndexes []crud.IndexID
 
+	// db is the prefixed kv store the underlying stores are built on
+	db       sdk.KVStore
 	objects  objects.Store
 	indexes  indexes.Store
 	metadata metadata.Store
 }
 
 func NewStore(cdc codec.Codec, db sdk.KVStore, pfx []byte, options ...crud.OptionFunc) Store {
-	prefixedStore := prefix.NewStore(db, pfx)
 	s := Store{
 		cdc:        cdc,
 		verifyType: DefaultVerifyType,
-		objects:    objects.NewStore(cdc, prefix.NewStore(prefixedStore, []byte{ObjectsPrefix})),
-		indexes:    indexes.NewStore(cdc, prefix.NewStore(prefixedStore, []byte{IndexesPrefix})),
-		metadata:   metadata.NewStore(cdc, prefix.NewStore(prefixedStore, []byte{MetadataPrefix})),
 	}
+	// options configure the store before its underlying stores are built
 	for _, opt := range options {
-		opt(s)
+		opt(&s)
+	}
+	return s.withDB(prefix.NewStore(db, pfx))
+}
+
+// withDB returns the store with its underlying stores built on the given kv store
+func (s Store) withDB(db sdk.KVStore) Store {
+	s.db = db
+	var objectsRanks, indexesRanks *ranks.Store
+	if s.ranked {
+		ranksStore := prefix.NewStore(db, []byte{RanksPrefix})
+		o, i := ranks.NewStore(prefix.NewStore(ranksStore, []byte{ObjectsPrefix})), ranks.NewStore(prefix.NewStore(ranksStore, []byte{IndexesPrefix}))
+		objectsRanks, indexesRanks = &o, &i
 	}
+	s.metadata = metadata.NewStore(prefix.NewStore(db, []byte{MetadataPrefix}))
+	s.objects = objects.NewStore(s.cdc, prefix.NewStore(db, []byte{ObjectsPrefix}), objectsRanks)
+	s.indexes = indexes.NewStore(s.cdc, prefix.NewStore(db, []byte{IndexesPrefix}), s.metadata, indexesRanks, s.uniqueIndexes)
 	return s
 }
 
+// atomic runs fn on a store whose underlying stores are built on a cache of the kv store,
+// the cache is written only if fn succeeds so that a failing mutation leaves the kv store untouched
+func (s Store) atomic(fn func(s Store) error) error {
+	cache := cachekv.NewStore(s.db)
+	err := fn(s.withDB(cache))
+	if err != nil {
+		return err
+	}
+	cache.Write()
+	return nil
+}
+
+// WithRanks makes the store maintain the ranks of the primary keys, among all the objects and per index value,
+// so that queries over all the objects or over a single index value reach the start of their range in logarithmic time
+// instead of going through the objects before it. This costs additional writes when objects are created or deleted.
+// The ranks of the objects already saved are not computed: setting it on a store which already holds objects
+// requires RebuildIndexes to be run once, which builds them.
+func WithRanks() crud.OptionFunc {
+	return func(store crud.Store) {
+		store.(*Store).ranked = true
+	}
+}
+
+// WithUniqueIndexes declares the given indexes unique: two objects cannot have the same value for them,
+// creating or updating an object which would have the same value as another one fails with crud.ErrUniqueViolation.
+// The objects already saved are not checked: declaring unique the indexes of a store which already holds objects
+// requires RebuildIndexes to be run once, which fails with crud.ErrUniqueViolation if two of them share a value.
+func WithUniqueIndexes(ids ...crud.IndexID) crud.OptionFunc {
+	return func(store crud.Store) {
+		s := store.(*Store)
+		s.uniqueIndexes = append(s.uniqueIndexes, ids...)
+	}
+}
+
 func (s Store) Create(o crud.Object) error {
+	return s.atomic(func(s Store) error {
+		return s.create(o)
+	})
+}
+
+// create creates the object, the changes made before an error are not undone
+func (s Store) create(o crud.Object) error {
 	err := s.objects.Create(o)
 	if err != nil {
 		return err
@@ -64,13 +133,9 @@ func (s Store) Create(o crud.Object) error {
 	// create indexes
 	err = s.indexes.Index(o)
 	if err != nil {
-		err2 := s.objects.Delete(o.PrimaryKey())
-		if err2 != nil {
-			panic(fmt.Errorf("state corruption unable to rollback delete after error %s: %s", err, err2))
-		}
 		return err
 	}
-	// done
+	s.metadata.IncreaseObjectCount()
 	return nil
 }
 
@@ -82,33 +147,135 @@ func (s Store) Read(primaryKey []byte, o crud.Object) error {
 }
 
 func (s Store) Update(o crud.Object) error {
-	// update indexes
-	err := s.indexes.Delete(o.PrimaryKey())
+	return s.atomic(func(s Store) error {
+		return s.update(o)
+	})
+}
+
+// update updates the object, the changes made before an error are not undone
+func (s Store) update(o crud.Object) error {
+	// update only the indexes which changed, unique indexes are checked before any change
+	err := s.indexes.Reindex(o)
 	if err != nil {
 		return err
 	}
-	err = s.indexes.Index(o)
+	return s.objects.Update(o)
+}
+
+// Save creates o, or updates it if an object with the same primary key exists, and returns true if it was created
+// created is false if Save fails, in which case nothing was saved
+func (s Store) Save(o crud.Object) (created bool, err error) {
+	err = s.atomic(func(s Store) error {
+		created, err = s.objects.Save(o)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return s.indexes.Reindex(o)
+		}
+		err = s.indexes.Index(o)
+		if err != nil {
+			return err
+		}
+		s.metadata.IncreaseObjectCount()
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// Modify reads the object identified by primaryKey to o and updates it once modified by fn, unless fn fails
+func (s Store) Modify(primaryKey []byte, o crud.Object, fn func(o crud.Object) error) error {
+	err := s.Read(primaryKey, o)
 	if err != nil {
-		// state corruption, cannot rollback TODO make rollback possible
-		panic(err)
+		return err
 	}
-	err = s.objects.Update(o)
+	err = fn(o)
 	if err != nil {
-		// state corruption panic
-		panic(err)
+		return err
 	}
-	return nil
+	if pk := o.PrimaryKey(); !bytes.Equal(pk, primaryKey) {
+		return fmt.Errorf("%w: primary key changed from %x to %x", crud.ErrBadArgument, primaryKey, pk)
+	}
+	return s.Update(o)
 }
 
 func (s Store) Delete(primaryKey []byte) error {
+	return s.atomic(func(s Store) error {
+		return s.remove(primaryKey)
+	})
+}
+
+// remove deletes the object, the changes made before an error are not undone
+func (s Store) remove(primaryKey []byte) error {
 	err := s.indexes.Delete(primaryKey)
 	if err != nil {
 		return err
 	}
 	err = s.objects.Delete(primaryKey)
 	if err != nil {
-		// state corruption, cannot rollback. todo make rollback possible
-		panic(err)
+		return err
+	}
+	return s.metadata.DecreaseObjectCount()
+}
+
+// CreateMany creates the objects in a single cache, which is written only if all of them are created
+func (s Store) CreateMany(objects []crud.Object) error {
+	return s.batch(objects, Store.create)
+}
+
+// UpdateMany updates the objects in a single cache, which is written only if all of them are updated
+func (s Store) UpdateMany(objects []crud.Object) error {
+	return s.batch(objects, Store.update)
+}
+
+// DeleteMany deletes the objects in a single cache, which is written only if all of them are deleted
+func (s Store) DeleteMany(primaryKeys [][]byte) error {
+	if err := checkDistinct(primaryKeys); err != nil {
+		return err
+	}
+	return s.atomic(func(s Store) error {
+		for i, primaryKey := range primaryKeys {
+			if err := s.remove(primaryKey); err != nil {
+				return &crud.BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// batch checks the objects are not nil and have distinct primary keys, then applies op to each of them in a single cache
+func (s Store) batch(objects []crud.Object, op func(s Store, o crud.Object) error) error {
+	primaryKeys := make([][]byte, len(objects))
+	for i, o := range objects {
+		if o == nil {
+			return &crud.BatchError{Index: i, Err: fmt.Errorf("%w: nil object", crud.ErrBadArgument)}
+		}
+		primaryKeys[i] = o.PrimaryKey()
+	}
+	if err := checkDistinct(primaryKeys); err != nil {
+		return err
+	}
+	return s.atomic(func(s Store) error {
+		for i, o := range objects {
+			if err := op(s, o); err != nil {
+				return &crud.BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// checkDistinct checks that the primary keys of a batch are distinct
+func checkDistinct(primaryKeys [][]byte) error {
+	seen := make(map[string]int, len(primaryKeys))
+	for i, primaryKey := range primaryKeys {
+		if j, ok := seen[string(primaryKey)]; ok {
+			return &crud.BatchError{Index: i, Err: fmt.Errorf("%w: primary key %x already given by element %d", crud.ErrBadArgument, primaryKey, j)}
+		}
+		seen[string(primaryKey)] = i
 	}
 	return nil
 }
@@ -117,21 +284,143 @@ func (s Store) Query() crud.QueryStatement {
 	return query.NewQuery(s)
 }
 
+func (s Store) QueryFrom(q *crud.Query) (crud.Cursor, error) {
+	return query.NewQueryFrom(s, q).Do()
+}
+
+// IsUniqueIndex is used by the query package, it tells if the given index was declared unique
+func (s Store) IsUniqueIndex(id crud.IndexID) bool {
+	return s.indexes.IsUnique(id)
+}
+
 // DoDirectQuery is used by the query package, the Query method is a more convenient way to query objects
-func (s Store) DoDirectQuery(sks []crud.SecondaryKey, start, end uint64) (crud.Cursor, error) {
-	var err error
-	var it types.Iterator
-	if len(sks) == 0 {
-		it, err = s.objects.GetAllKeysWithIterator(start, end)
-	} else {
-		it, err = s.indexes.FilterWithIterator(sks, start, end)
-	}
+func (s Store) DoDirectQuery(q types.Query) (crud.Cursor, error) {
+	it, err := s.keysIterator(q)
 	if err != nil {
 		return nil, err
 	}
 	return newFilter(it, &s), nil
 }
 
+// DoDirectCount is used by the query package, the Query method is a more convenient way to count objects
+func (s Store) DoDirectCount(q types.Query) (uint64, error) {
+	if len(q.Filters) != 0 {
+		// the objects must be decoded to know if they pass the filters
+		it, err := s.keysIterator(q)
+		if err != nil {
+			return 0, err
+		}
+		var count uint64
+		for ; it.Valid(); it.Next() {
+			count++
+		}
+		return count, it.Error()
+	}
+	if len(q.Conjunctions) != 0 || q.OrderBy != nil {
+		return s.indexes.Count(q, s.objects.GetKeysFrom)
+	}
+	if q.From == nil {
+		rng, err := util.NewRange(q.Start, q.End)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", crud.ErrBadArgument, err)
+		}
+		return rng.Length(s.metadata.ObjectCount()), nil
+	}
+	// the objects count does not tell how many objects come after a given one
+	it, err := s.objects.GetKeysFrom(q.From, q.Start, q.End, q.Descending)
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for ; it.Valid(); it.Next() {
+		count++
+	}
+	return count, it.Error()
+}
+
+// DoDirectIndexValues is used by the query package, the IndexValues method of queries is a more convenient way to list index values
+func (s Store) DoDirectIndexValues(id crud.IndexID, q types.Query) (crud.IndexValueCursor, error) {
+	it, err := s.indexes.Values(id, q.From, q.Start, q.End, q.Descending)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexValueCursor{it}, nil
+}
+
+// keysIterator returns an iterator over the primary keys of the objects selected by the query
+func (s Store) keysIterator(q types.Query) (types.Iterator, error) {
+	if len(q.Filters) != 0 {
+		return s.filteredKeysIterator(q)
+	}
+	if len(q.Conjunctions) == 0 && q.OrderBy == nil {
+		return s.objects.GetKeysFrom(q.From, q.Start, q.End, q.Descending)
+	}
+	return s.indexes.FilterWithIterator(q, s.objects.GetKeysFrom)
+}
+
+// filteredIterator iterates over the primary keys of the objects passing the filters of a query,
+// it keeps the object decoded to check them so that the cursor does not decode it again
+type filteredIterator struct {
+	*iterator.KeyIterator
+	// object is the decoded object of the current primary key, nil once taken by the cursor
+	object crud.Object
+}
+
+// filteredKeysIterator returns an iterator over the primary keys of the objects selected by the query
+// which pass its filters, the range of the query applies to them
+func (s Store) filteredKeysIterator(q types.Query) (types.Iterator, error) {
+	rng, err := util.NewRange(q.Start, q.End)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", crud.ErrBadArgument, err)
+	}
+	unfiltered := q
+	unfiltered.Filters, unfiltered.Start, unfiltered.End = nil, 0, 0
+	it, err := s.keysIterator(unfiltered)
+	if err != nil {
+		return nil, err
+	}
+	filtered := &filteredIterator{}
+	filtered.KeyIterator = iterator.NewPositionedKeyIterator(func() ([]byte, []byte, bool, error) {
+		filtered.object = nil
+		for it.Valid() {
+			primaryKey, position := it.Get(), it.Position()
+			it.Next()
+			o, ok, err := s.pass(q.Filters, primaryKey)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			inRange, stopIter := rng.CheckAndMoveForward()
+			if stopIter {
+				return nil, nil, false, nil
+			}
+			if inRange {
+				filtered.object = o
+				return primaryKey, position, true, nil
+			}
+		}
+		return nil, nil, false, it.Error()
+	})
+	return filtered, nil
+}
+
+// pass decodes the object identified by primaryKey to the object of the first filter and checks it passes all the filters
+// the decoded object is returned along with the result
+func (s Store) pass(filters []types.Filter, primaryKey []byte) (crud.Object, bool, error) {
+	o := filters[0].NewObject()
+	if err := s.objects.Read(primaryKey, o); err != nil {
+		return nil, false, fmt.Errorf("%w: unable to decode object %x to %T: %s", crud.ErrInternal, primaryKey, o, err)
+	}
+	for _, filter := range filters {
+		if !filter.Predicate(o) {
+			return o, false, nil
+		}
+	}
+	return o, true, nil
+}
+
 func newFilter(it types.Iterator, store *Store) *Cursor {
 	return &Cursor{
 		keyIterator: it,
@@ -151,27 +440,69 @@ func (c *Cursor) Next() {
 
 // Read reads the current element of this cursor and store it to o
 // o must be an already allocated object
+// the object decoded to check the filters of the query, if any, is copied to o if it has the same type
 func (c *Cursor) Read(o crud.Object) error {
+	if filtered, ok := c.keyIterator.(*filteredIterator); ok && filtered.object != nil {
+		if decoded := filtered.object; reflect.TypeOf(decoded) == reflect.TypeOf(o) && reflect.TypeOf(o).Kind() == reflect.Ptr {
+			// the decoded object is given once, so that o does not share its content with another object
+			filtered.object = nil
+			reflect.ValueOf(o).Elem().Set(reflect.ValueOf(decoded).Elem())
+			return nil
+		}
+	}
 	return c.store.Read(c.currKey(), o)
 }
 
 // Delete deletes the current element of this cursor
 // Delete, Read or Update should not be called on this cursor before a call to Next and will cause a ErrNotFound error
 func (c *Cursor) Delete() error {
+	c.dropDecoded()
 	return c.store.Delete(c.currKey())
 }
 
 // Update updates the current element of this cursor with the given object
 // Delete, Read or Update should not be called on this cursor before a call to Next and may cause a ErrNotFound error
 func (c *Cursor) Update(o crud.Object) error {
+	c.dropDecoded()
 	return c.store.Update(o)
 }
 
+// dropDecoded drops the object decoded to check the filters, which does not reflect the store after a change
+func (c *Cursor) dropDecoded() {
+	if filtered, ok := c.keyIterator.(*filteredIterator); ok {
+		filtered.object = nil
+	}
+}
+
 // Valid indicates if there is remaining data for this cursor
 func (c *Cursor) Valid() bool {
 	return c.keyIterator.Valid()
 }
 
+// Error returns the error which made this cursor stop before the last element, if any
+func (c *Cursor) Error() error {
+	return c.keyIterator.Error()
+}
+
+// NextKey returns the key from which a query identical to the one of this cursor resumes at the current element
+// it returns nil if the cursor is fully consumed
+func (c *Cursor) NextKey() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.keyIterator.Position()
+}
+
 func (c *Cursor) currKey() []byte {
 	return c.keyIterator.Get()
 }
+
+type IndexValueCursor struct {
+	*indexes.ValuesIterator
+}
+
+// NextKey returns the key from which an identical listing resumes at the current value
+// it returns nil if the cursor is fully consumed
+func (c *IndexValueCursor) NextKey() []byte {
+	return c.Position()
+}
@@ -2,13 +2,16 @@ package types
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/store/prefix"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 
 	crud "github.com/iov-one/cosmos-sdk-crud"
+	"github.com/iov-one/cosmos-sdk-crud/internal/store/types"
 	"github.com/iov-one/cosmos-sdk-crud/internal/test"
 )
 
@@ -48,9 +51,9 @@ func TestStore(t *testing.T) {
 		t.Fatal(err)
 	}
 	// test cursor
-	crs, err := s.DoDirectQuery([]crud.SecondaryKey{
+	crs, err := s.DoDirectQuery(types.Query{Conjunctions: equalities([]crud.SecondaryKey{
 		update.FirstSecondaryKey(),
-	}, 0, 0)
+	})})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -132,7 +135,7 @@ func TestStore(t *testing.T) {
 		if err = s.Create(obj); err != nil {
 			t.Fatal("Unexpected error :", err)
 		}
-		cursor, err := s.DoDirectQuery(obj.SecondaryKeys(), 0, 0)
+		cursor, err := s.DoDirectQuery(types.Query{Conjunctions: equalities(obj.SecondaryKeys())})
 		if err != nil {
 			t.Fatal("Unexpected error :", err)
 		}
@@ -157,7 +160,7 @@ func TestStore(t *testing.T) {
 	t.Run("query all", func(t *testing.T) {
 		s, objs := createStoreWithRandomObjects(cdc, db, t, 50, "queryall")
 
-		results, err := s.DoDirectQuery(nil, 0, 0)
+		results, err := s.DoDirectQuery(types.Query{})
 		if err != nil {
 			t.Fatal("unexpected error", err)
 		}
@@ -222,6 +225,77 @@ func Test_query(t *testing.T) {
 		}
 	})
 
+	t.Run("success/range", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x0).Between([]byte("a"), []byte("b")).
+			And().Index(0x1).GreaterThan([]byte("")).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/prefix", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x0).HasPrefix([]byte("")).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/or", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x0).In([]byte("a"), []byte("b")).
+			Or().Index(0x0).Equals([]byte("c")).And().Index(0x1).Equals([]byte("d")).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/and not on same index", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x0).HasPrefix([]byte("a")).
+			AndNot().Index(0x0).Equals([]byte("ab")).
+			And().Index(0x0).NotEquals([]byte("ac")).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/equalities on same index", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x1).Equals([]byte("1")).And().Index(0x1).Equals([]byte{0x1}).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/ordered", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err = q.Where().Index(0x0).HasPrefix([]byte("a")).OrderBy(0x1).Descending().Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("success/count follows creates and deletes", func(t *testing.T) {
+		db, cdc, err := test.NewStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, objs := createStoreWithRandomObjects(cdc, db, t, 5, "count")
+		test.CheckNoError(t, s.Delete(objs[0].PrimaryKey()))
+		count, err := s.Query().Count()
+		test.CheckNoError(t, err)
+		if count != 4 {
+			t.Fatalf("unexpected count, expected 4, got %d", count)
+		}
+		count, err = s.Query().Where().Index(0x0).Equals(objs[0].SecondaryKeys()[0].Value).Count()
+		test.CheckNoError(t, err)
+		if count != 0 {
+			t.Fatalf("unexpected count for deleted object, got %d", count)
+		}
+	})
+
 	t.Run("bad argument/already consumed", func(t *testing.T) {
 		_, _ = q.Do() // do it twice in case we run this subtest only!
 		_, err := q.Do()
@@ -230,9 +304,45 @@ func Test_query(t *testing.T) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
-	t.Run("bad argument/multiple indexes with same id", func(t *testing.T) {
+	t.Run("bad argument/empty contains all", func(t *testing.T) {
 		q := crudStore.Query()
-		q.Where().Index(0x1).Equals([]byte("1")).And().Index(0x1).Equals([]byte{0x1})
+		q.Where().Index(0x1).ContainsAll()
+		_, err := q.Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/negated contains all", func(t *testing.T) {
+		q := crudStore.Query()
+		q.Where().Index(0x0).Equals([]byte("a")).AndNot().Index(0x1).ContainsAll([]byte("1"), []byte("2"))
+		_, err := q.Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/nil range", func(t *testing.T) {
+		q := crudStore.Query()
+		q.Where().Index(0x1).LessOrEqual(nil)
+		_, err := q.Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/inverted between", func(t *testing.T) {
+		q := crudStore.Query()
+		q.Where().Index(0x1).Between([]byte("b"), []byte("a"))
+		_, err := q.Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/empty in", func(t *testing.T) {
+		q := crudStore.Query()
+		q.Where().Index(0x1).In()
 		_, err := q.Do()
 		t.Logf("%s", err)
 		if !errors.Is(err, crud.ErrBadArgument) {
@@ -248,6 +358,30 @@ func Test_query(t *testing.T) {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
+	t.Run("bad argument/nil component", func(t *testing.T) {
+		q := crudStore.Query()
+		q.Where().Index(0x1).Components([]byte("a"), nil).Equals([]byte("b"))
+		_, err := q.Do()
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/resume from nil key", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err := q.ResumeFrom(nil).Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("bad argument/ordered twice", func(t *testing.T) {
+		q := crudStore.Query()
+		_, err := q.OrderBy(0x0).OrderBy(0x1).Do()
+		t.Logf("%s", err)
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
 
 }
 
@@ -258,3 +392,1338 @@ func createStoreWithRandomObjects(cdc codec.Codec, db sdk.KVStore, t *testing.T,
 	}
 	return store, test.CreateRandomObjects(addToStore, t, n)
 }
+
+func equalities(sks []crud.SecondaryKey) []types.Conjunction {
+	predicates := make([]types.Predicate, len(sks))
+	for i, sk := range sks {
+		predicates[i] = types.NewEqualityPredicate(sk)
+	}
+	return []types.Conjunction{{Predicates: predicates}}
+}
+
+func Test_ranks(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ranked store must return the same results as the store iterating over the objects before the range
+	plain := NewStore(cdc, db, []byte("plain"))
+	ranked := NewStore(cdc, db, []byte("ranked"), WithRanks())
+	for i := 0; i < 300; i++ {
+		parity := []string{"even", "odd"}[i%2]
+		obj := test.NewCustomObject(fmt.Sprintf("pk%03d", i), parity, fmt.Sprintf("sk%d", i%7))
+		test.CheckNoError(t, plain.Create(obj))
+		test.CheckNoError(t, ranked.Create(obj))
+	}
+	for i := 0; i < 300; i += 5 {
+		pk := []byte(fmt.Sprintf("pk%03d", i))
+		test.CheckNoError(t, plain.Delete(pk))
+		test.CheckNoError(t, ranked.Delete(pk))
+	}
+
+	collect := func(t *testing.T, s Store, q types.Query) []string {
+		crs, err := s.DoDirectQuery(q)
+		test.CheckNoError(t, err)
+		pks := []string{}
+		for ; crs.Valid(); crs.Next() {
+			pks = append(pks, string(crs.(*Cursor).currKey()))
+		}
+		return pks
+	}
+	queries := map[string][]types.Conjunction{
+		"all":         nil,
+		"index value": equalities([]crud.SecondaryKey{{ID: 0x0, Value: []byte("odd")}}),
+		"not ranked":  equalities([]crud.SecondaryKey{{ID: 0x0, Value: []byte("odd")}, {ID: 0x1, Value: []byte("sk3")}}),
+	}
+	// the ranks of a store created without them are built by RebuildIndexes
+	late := NewStore(cdc, db, []byte("late"))
+	for i := 0; i < 300; i++ {
+		if i%5 == 0 {
+			continue
+		}
+		parity := []string{"even", "odd"}[i%2]
+		test.CheckNoError(t, late.Create(test.NewCustomObject(fmt.Sprintf("pk%03d", i), parity, fmt.Sprintf("sk%d", i%7))))
+	}
+	late = NewStore(cdc, db, []byte("late"), WithRanks())
+	test.CheckNoError(t, late.RebuildIndexes(func() crud.Object { return test.NewObject() }))
+
+	ranges := [][2]uint64{{1, 0}, {17, 43}, {100, 101}, {119, 0}, {239, 0}, {240, 250}, {1000, 0}}
+	for name, conjunctions := range queries {
+		for _, rng := range ranges {
+			for _, descending := range []bool{false, true} {
+				q := types.Query{Conjunctions: conjunctions, Start: rng[0], End: rng[1], Descending: descending}
+				t.Run(fmt.Sprintf("%s/%d-%d/descending=%t", name, rng[0], rng[1], descending), func(t *testing.T) {
+					expected, actual := collect(t, plain, q), collect(t, ranked, q)
+					if !reflect.DeepEqual(expected, actual) {
+						t.Fatal("Unexpected results (expected :", expected, ", actual :", actual, ")")
+					}
+					if actual := collect(t, late, q); !reflect.DeepEqual(expected, actual) {
+						t.Fatal("Unexpected results after rebuilding the indexes (expected :", expected, ", actual :", actual, ")")
+					}
+				})
+			}
+		}
+	}
+}
+
+// Test_ranksInCache mutates a ranked store through cursors in a cached context, as in DeliverTx,
+// the ranks must be maintained without opening iterators on the cache while the cursor iterates over it
+func Test_ranksInCache(t *testing.T) {
+	ctx, key, cdc, err := test.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = ctx.WithMultiStore(ctx.MultiStore().CacheMultiStore())
+	s := NewStore(cdc, ctx.KVStore(key), []byte("ranked"), WithRanks())
+	// enough objects for the iterators of the cache not to be read at once
+	const n = 500
+	for i := 0; i < n; i++ {
+		parity := []string{"even", "odd"}[i%2]
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%03d", i), parity, "b")))
+	}
+
+	t.Run("update", func(t *testing.T) {
+		crs, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("odd")).Do()
+		test.CheckNoError(t, err)
+		for ; crs.Valid(); crs.Next() {
+			obj := test.NewObject()
+			test.CheckNoError(t, crs.Read(obj))
+			obj.TestSecondaryKeyB = []byte("odd")
+			test.CheckNoError(t, crs.Update(obj))
+		}
+		test.CheckNoError(t, crs.Error())
+		count, err := s.Query().Where().Index(test.IndexID_B).Equals([]byte("odd")).Count()
+		test.CheckNoError(t, err)
+		if count != n/2 {
+			t.Fatalf("Unexpected count (expected : %d, actual : %d)", n/2, count)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		crs, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("even")).Do()
+		test.CheckNoError(t, err)
+		for ; crs.Valid(); crs.Next() {
+			test.CheckNoError(t, crs.Delete())
+		}
+		test.CheckNoError(t, crs.Error())
+		// the ranks find the objects left, the cursors are consumed as they would block the next iterators
+		queries := map[string]crud.ValidQuery{
+			"pk021":                    s.Query().Where().Index(test.IndexID_B).Equals([]byte("odd")).WithRange().Start(10).End(11),
+			fmt.Sprintf("pk%03d", n-1): s.Query().WithRange().Start(n/2 - 1).End(0),
+		}
+		for expected, q := range queries {
+			crs, err := q.Do()
+			test.CheckNoError(t, err)
+			var actual []string
+			for ; crs.Valid(); crs.Next() {
+				actual = append(actual, string(crs.(*Cursor).currKey()))
+			}
+			if !reflect.DeepEqual(actual, []string{expected}) {
+				t.Fatal("Unexpected results (expected :", expected, ", actual :", actual, ")")
+			}
+		}
+	})
+}
+
+func Test_unique(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, []byte("unique"), WithUniqueIndexes(test.IndexID_B))
+	obj1, obj2 := test.NewCustomObject("pk1", "shared", "unique1"), test.NewCustomObject("pk2", "shared", "unique2")
+	test.CheckNoError(t, s.Create(obj1))
+	test.CheckNoError(t, s.Create(obj2))
+
+	t.Run("create/violation", func(t *testing.T) {
+		err := s.Create(test.NewCustomObject("pk3", "other", "unique1"))
+		if !errors.Is(err, crud.ErrUniqueViolation) || !errors.Is(err, crud.ErrAlreadyExists) {
+			t.Fatal("unexpected error", err)
+		}
+		// the error names the index, the value and the object already having it
+		var violation *crud.UniqueViolationError
+		if !errors.As(err, &violation) {
+			t.Fatal("unexpected error type", err)
+		}
+		if violation.ID != test.IndexID_B || string(violation.Value) != "unique1" || string(violation.ConflictingKey) != "pk1" {
+			t.Fatalf("unexpected violation %+v", violation)
+		}
+		if err := s.Read([]byte("pk3"), test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("the object should not have been created", err)
+		}
+	})
+	t.Run("update/violation", func(t *testing.T) {
+		err := s.Update(test.NewCustomObject("pk2", "changed", "unique1"))
+		var violation *crud.UniqueViolationError
+		if !errors.As(err, &violation) || string(violation.ConflictingKey) != "pk1" {
+			t.Fatal("unexpected error", err)
+		}
+		actual := test.NewObject()
+		if err := s.Query().GetUnique(test.IndexID_B, []byte("unique2"), actual); err != nil {
+			t.Fatal("the indexes of the object should not have changed", err)
+		}
+		if err := actual.Equals(&obj2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("update/same value", func(t *testing.T) {
+		test.CheckNoError(t, s.Update(test.NewCustomObject("pk1", "changed", "unique1")))
+	})
+	t.Run("released values", func(t *testing.T) {
+		// the values an object loses, by update or deletion, can be taken by other objects
+		test.CheckNoError(t, s.Create(test.NewCustomObject("pk3", "other", "unique3")))
+		test.CheckNoError(t, s.Update(test.NewCustomObject("pk3", "other", "unique4")))
+		test.CheckNoError(t, s.Create(test.NewCustomObject("pk4", "other", "unique3")))
+		test.CheckNoError(t, s.Delete([]byte("pk4")))
+		test.CheckNoError(t, s.Update(test.NewCustomObject("pk3", "other", "unique3")))
+		test.CheckNoError(t, s.Delete([]byte("pk3")))
+	})
+	t.Run("get unique", func(t *testing.T) {
+		actual := test.NewObject()
+		test.CheckNoError(t, s.Query().GetUnique(test.IndexID_B, []byte("unique2"), actual))
+		if err := actual.Equals(&obj2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("get unique/not found", func(t *testing.T) {
+		if err := s.Query().GetUnique(test.IndexID_B, []byte("unique3"), test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("get unique/not unique index", func(t *testing.T) {
+		if err := s.Query().GetUnique(test.IndexID_A, []byte("shared"), test.NewObject()); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("declared later", func(t *testing.T) {
+		// the values of the objects saved before the index was declared unique are checked by RebuildIndexes
+		late := NewStore(cdc, db, []byte("late"))
+		test.CheckNoError(t, late.Create(test.NewCustomObject("pk1", "shared", "unique1")))
+		test.CheckNoError(t, late.Create(test.NewCustomObject("pk2", "shared", "unique2")))
+		late = NewStore(cdc, db, []byte("late"), WithUniqueIndexes(test.IndexID_B))
+		test.CheckNoError(t, late.RebuildIndexes(func() crud.Object { return test.NewObject() }))
+		if err := late.Create(test.NewCustomObject("pk3", "other", "unique1")); !errors.Is(err, crud.ErrUniqueViolation) {
+			t.Fatal("unexpected error", err)
+		}
+		actual := test.NewObject()
+		test.CheckNoError(t, late.Query().GetUnique(test.IndexID_B, []byte("unique2"), actual))
+		if string(actual.PrimaryKey()) != "pk2" {
+			t.Fatal("unexpected object", actual)
+		}
+
+		shared := NewStore(cdc, db, []byte("late"), WithUniqueIndexes(test.IndexID_A))
+		expected := snapshot(db)
+		if err := shared.RebuildIndexes(func() crud.Object { return test.NewObject() }); !errors.Is(err, crud.ErrUniqueViolation) {
+			t.Fatal("unexpected error", err)
+		}
+		if actual := snapshot(db); !reflect.DeepEqual(actual, expected) {
+			t.Fatal("the store should not have changed")
+		}
+	})
+}
+
+func Test_multiValued(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	test.CheckNoError(t, s.Create(tagsObject{test.NewCustomObject("pk1", "a", "b")}))
+	test.CheckNoError(t, s.Create(tagsObject{test.NewCustomObject("pk2", "b", "c")}))
+	test.CheckNoError(t, s.Create(tagsObject{test.NewCustomObject("pk3", "c", "c")}))
+
+	cases := map[string]struct {
+		query    func(q crud.QueryStatement) crud.ValidQuery
+		expected []string
+	}{
+		"contains all": {
+			query: func(q crud.QueryStatement) crud.ValidQuery {
+				return q.Where().Index(test.IndexID_A).ContainsAll([]byte("b"), []byte("c"))
+			},
+			expected: []string{"pk2"},
+		},
+		"contains all/single value": {
+			query: func(q crud.QueryStatement) crud.ValidQuery {
+				return q.Where().Index(test.IndexID_A).ContainsAll([]byte("c"))
+			},
+			expected: []string{"pk2", "pk3"},
+		},
+		"contains all/missing value": {
+			query: func(q crud.QueryStatement) crud.ValidQuery {
+				return q.Where().Index(test.IndexID_A).ContainsAll([]byte("a"), []byte("c"))
+			},
+		},
+		"contains any": {
+			query: func(q crud.QueryStatement) crud.ValidQuery {
+				return q.Where().Index(test.IndexID_A).ContainsAny([]byte("a"), []byte("c"))
+			},
+			expected: []string{"pk1", "pk2", "pk3"},
+		},
+		"contains any/excluded": {
+			query: func(q crud.QueryStatement) crud.ValidQuery {
+				return q.Where().Index(test.IndexID_A).ContainsAny([]byte("b"), []byte("c")).
+					AndNot().Index(test.IndexID_A).Equals([]byte("a"))
+			},
+			expected: []string{"pk2", "pk3"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := test.QueryKeys(t, c.query(s.Query())); !reflect.DeepEqual(actual, c.expected) {
+				t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", c.expected, actual)
+			}
+			count, err := c.query(s.Query()).Count()
+			test.CheckNoError(t, err)
+			if count != uint64(len(c.expected)) {
+				t.Fatalf("unexpected count (expected : %d, actual : %d)", len(c.expected), count)
+			}
+		})
+	}
+	t.Run("delete", func(t *testing.T) {
+		test.CheckNoError(t, s.Delete([]byte("pk3")))
+		if actual := test.QueryKeys(t, s.Query().Where().Index(test.IndexID_A).Equals([]byte("c"))); !reflect.DeepEqual(actual, []string{"pk2"}) {
+			t.Fatal("unexpected primary keys", actual)
+		}
+	})
+}
+
+// tagsObject is an object whose two values are tags of a multi-valued index
+type tagsObject struct {
+	test.Object
+}
+
+func (o tagsObject) SecondaryKeys() []crud.SecondaryKey {
+	return []crud.SecondaryKey{
+		{ID: test.IndexID_A, Value: o.TestSecondaryKeyA},
+		{ID: test.IndexID_A, Value: o.TestSecondaryKeyB},
+	}
+}
+
+func Test_indexValues(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	// value "b" of index A is shared by two objects, an object of the multi-valued index has two values
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk1", "a", "x")))
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk2", "b", "y")))
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk3", "b", "z")))
+	test.CheckNoError(t, s.Create(tagsObject{test.NewCustomObject("pk4", "c", "\x00")}))
+
+	// values returns at most n values of the cursor of the query with their counts, all of them if n is 0, and the key to resume from
+	values := func(t *testing.T, q crud.ValidQuery, n int) (actual []string, nextKey []byte) {
+		crs, err := q.IndexValues(test.IndexID_A)
+		test.CheckNoError(t, err)
+		for ; crs.Valid() && (n == 0 || len(actual) < n); crs.Next() {
+			actual = append(actual, fmt.Sprintf("%s:%d", crs.Value(), crs.Count()))
+		}
+		test.CheckNoError(t, crs.Error())
+		return actual, crs.NextKey()
+	}
+	cases := map[string]struct {
+		query    func() crud.ValidQuery
+		expected []string
+	}{
+		"all": {
+			query:    func() crud.ValidQuery { return s.Query() },
+			expected: []string{"\x00:1", "a:1", "b:2", "c:1"},
+		},
+		"descending": {
+			query:    func() crud.ValidQuery { return s.Query().Descending() },
+			expected: []string{"c:1", "b:2", "a:1", "\x00:1"},
+		},
+		"range": {
+			query:    func() crud.ValidQuery { return s.Query().WithRange().Start(1).End(3) },
+			expected: []string{"a:1", "b:2"},
+		},
+		"range/descending": {
+			query:    func() crud.ValidQuery { return s.Query().WithRange().Start(1).End(0).Descending() },
+			expected: []string{"b:2", "a:1", "\x00:1"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual, _ := values(t, c.query(), 0); !reflect.DeepEqual(actual, c.expected) {
+				t.Fatalf("unexpected values (expected : %q, actual : %q)", c.expected, actual)
+			}
+		})
+	}
+	for _, descending := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pages/descending %t", descending), func(t *testing.T) {
+			// query returns the query of the listing, resuming from nextKey if not nil
+			query := func(nextKey []byte) crud.ValidQuery {
+				var q crud.ValidQuery = s.Query()
+				if descending {
+					q = q.Descending()
+				}
+				if nextKey != nil {
+					q = q.ResumeFrom(nextKey)
+				}
+				return q
+			}
+			all, _ := values(t, query(nil), 0)
+			var paged []string
+			var nextKey []byte
+			for {
+				page, next := values(t, query(nextKey), 3)
+				paged = append(paged, page...)
+				if next == nil {
+					break
+				}
+				nextKey = next
+			}
+			if !reflect.DeepEqual(paged, all) {
+				t.Fatalf("unexpected values (expected : %q, actual : %q)", all, paged)
+			}
+		})
+	}
+	t.Run("deleted objects", func(t *testing.T) {
+		test.CheckNoError(t, s.Delete([]byte("pk1")))
+		test.CheckNoError(t, s.Delete([]byte("pk2")))
+		expected := []string{"\x00:1", "b:1", "c:1"}
+		if actual, _ := values(t, s.Query(), 0); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected values (expected : %q, actual : %q)", expected, actual)
+		}
+	})
+	t.Run("bad argument/position of another index", func(t *testing.T) {
+		crs, err := s.Query().IndexValues(test.IndexID_A)
+		test.CheckNoError(t, err)
+		if _, err := s.Query().ResumeFrom(crs.NextKey()).IndexValues(test.IndexID_B); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("bad argument/empty range", func(t *testing.T) {
+		if _, err := s.Query().WithRange().Start(2).End(2).IndexValues(test.IndexID_A); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("bad argument/clauses", func(t *testing.T) {
+		if _, err := s.Query().Where().Index(test.IndexID_B).Equals([]byte("z")).IndexValues(test.IndexID_A); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := s.Query().OrderBy(test.IndexID_B).IndexValues(test.IndexID_A); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("corrupted counter", func(t *testing.T) {
+		// a counter whose key is not an encoded index key, after the ones of the values of index A
+		prefix.NewStore(db, []byte{MetadataPrefix, 0x1}).Set([]byte{byte(test.IndexID_A), 'd'}, sdk.Uint64ToBigEndian(1))
+		crs, err := s.Query().IndexValues(test.IndexID_A)
+		test.CheckNoError(t, err)
+		var actual []string
+		for ; crs.Valid(); crs.Next() {
+			actual = append(actual, string(crs.Value()))
+		}
+		if expected := []string{"\x00", "b", "c"}; !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected values (expected : %q, actual : %q)", expected, actual)
+		}
+		if err := crs.Error(); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+func Test_group(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+
+	a := func(where crud.WhereStatement, v string) crud.FinalizedIndexStatement {
+		return where.Index(test.IndexID_A).Equals([]byte(v))
+	}
+	b := func(where crud.WhereStatement, v string) crud.FinalizedIndexStatement {
+		return where.Index(test.IndexID_B).Equals([]byte(v))
+	}
+
+	cases := map[string]struct {
+		query    func() crud.ValidQuery
+		expected []string
+	}{
+		"and group": {
+			// b < b8 and (a0 or (a1 and b > b3))
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_B).LessThan([]byte("b8")).
+					And().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return a(where, "a0").Or().Index(test.IndexID_A).Equals([]byte("a1")).And().Index(test.IndexID_B).GreaterThan([]byte("b3"))
+				})
+			},
+			expected: []string{"pk0", "pk3", "pk4", "pk6", "pk7"},
+		},
+		"group first": {
+			// (a0 or a1) and b > b5
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return a(where, "a0").Or().Index(test.IndexID_A).Equals([]byte("a1"))
+				}).And().Index(test.IndexID_B).GreaterThan([]byte("b5"))
+			},
+			expected: []string{"pk6", "pk7", "pk9"},
+		},
+		"groups and or": {
+			// (b1 or b2 or b8) and (a1 or a2) or b9
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return b(where, "b1").Or().Index(test.IndexID_B).In([]byte("b2"), []byte("b8"))
+				}).And().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return a(where, "a1").Or().Index(test.IndexID_A).Equals([]byte("a2"))
+				}).Or().Index(test.IndexID_B).Equals([]byte("b9"))
+			},
+			expected: []string{"pk1", "pk2", "pk8", "pk9"},
+		},
+		"negated group": {
+			// a0 and not (b0 or b3)
+			query: func() crud.ValidQuery {
+				return a(s.Query().Where(), "a0").AndNot().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return b(where, "b0").Or().Index(test.IndexID_B).Equals([]byte("b3"))
+				})
+			},
+			expected: []string{"pk6", "pk9"},
+		},
+		"nested groups": {
+			// a0 and (b0 or (b < b7 and (b6 or b3)))
+			query: func() crud.ValidQuery {
+				return a(s.Query().Where(), "a0").And().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+					return b(where, "b0").Or().Index(test.IndexID_B).LessThan([]byte("b7")).And().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+						return b(where, "b6").Or().Index(test.IndexID_B).Equals([]byte("b3"))
+					})
+				})
+			},
+			expected: []string{"pk0", "pk3", "pk6"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := test.QueryKeys(t, c.query()); !reflect.DeepEqual(actual, c.expected) {
+				t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", c.expected, actual)
+			}
+		})
+	}
+
+	errorCases := map[string]func() crud.ValidQuery{
+		"nil group": func() crud.ValidQuery {
+			return s.Query().Where().Group(nil)
+		},
+		"empty group": func() crud.ValidQuery {
+			return s.Query().Where().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement { return nil })
+		},
+		"error in group": func() crud.ValidQuery {
+			return s.Query().Where().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+				return a(where, "a0").Or().Index(test.IndexID_B).Equals(nil)
+			})
+		},
+		"modifier in group": func() crud.ValidQuery {
+			return s.Query().Where().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+				a(where, "a0").Descending()
+				return nil
+			})
+		},
+		"negated group of several conditions": func() crud.ValidQuery {
+			return a(s.Query().Where(), "a0").AndNot().Group(func(where crud.WhereStatement) crud.FinalizedIndexStatement {
+				return b(where, "b0").And().Index(test.IndexID_B).Equals([]byte("b3"))
+			})
+		},
+	}
+	for name, query := range errorCases {
+		t.Run("bad argument/"+name, func(t *testing.T) {
+			if _, err := query().Do(); !errors.Is(err, crud.ErrBadArgument) {
+				t.Fatal("unexpected error", err)
+			}
+		})
+	}
+}
+
+func Test_queryFrom(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+
+	// run sends the query through its protobuf encoding before running it
+	run := func(t *testing.T, q *crud.Query) (crud.Cursor, error) {
+		b, err := q.Marshal()
+		test.CheckNoError(t, err)
+		decoded := new(crud.Query)
+		test.CheckNoError(t, decoded.Unmarshal(b))
+		return s.QueryFrom(decoded)
+	}
+	clause := func(id crud.IndexID, op crud.Operator, values ...string) *crud.Clause {
+		c := &crud.Clause{IndexId: uint32(id), Operator: op}
+		for _, v := range values {
+			c.Values = append(c.Values, []byte(v))
+		}
+		return c
+	}
+
+	cases := map[string]struct {
+		query    *crud.Query
+		expected crud.ValidQuery
+	}{
+		"all": {
+			query:    &crud.Query{},
+			expected: s.Query(),
+		},
+		"and": {
+			query: &crud.Query{Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+				clause(test.IndexID_A, crud.Operator_OPERATOR_EQUAL, "a1"),
+				clause(test.IndexID_B, crud.Operator_OPERATOR_LESS_THAN, "b5"),
+			}}}},
+			expected: s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).
+				And().Index(test.IndexID_B).LessThan([]byte("b5")),
+		},
+		"or and negation": {
+			query: &crud.Query{Conjunctions: []*crud.Conjunction{
+				{Clauses: []*crud.Clause{
+					clause(test.IndexID_A, crud.Operator_OPERATOR_IN, "a0", "a2"),
+					{IndexId: uint32(test.IndexID_B), Operator: crud.Operator_OPERATOR_BETWEEN, Values: [][]byte{[]byte("b2"), []byte("b6")}, Negated: true},
+				}},
+				{Clauses: []*crud.Clause{clause(test.IndexID_B, crud.Operator_OPERATOR_PREFIX, "b4")}},
+			}},
+			expected: s.Query().Where().Index(test.IndexID_A).In([]byte("a0"), []byte("a2")).
+				AndNot().Index(test.IndexID_B).Between([]byte("b2"), []byte("b6")).
+				Or().Index(test.IndexID_B).HasPrefix([]byte("b4")),
+		},
+		"exists": {
+			query: &crud.Query{Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+				clause(test.IndexID_A, crud.Operator_OPERATOR_EXISTS),
+			}}}},
+			expected: s.Query().Where().Index(test.IndexID_A).Exists(),
+		},
+		"range, order and pagination": {
+			query: &crud.Query{
+				Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+					clause(test.IndexID_B, crud.Operator_OPERATOR_GREATER_OR_EQUAL, "b1"),
+				}}},
+				Start:      1,
+				End:        4,
+				Descending: true,
+				OrderBy:    &crud.OrderBy{IndexId: uint32(test.IndexID_A)},
+			},
+			expected: s.Query().Where().Index(test.IndexID_B).GreaterOrEqual([]byte("b1")).
+				WithRange().Start(1).End(4).OrderBy(test.IndexID_A).Descending(),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			crs, err := run(t, c.query)
+			test.CheckNoError(t, err)
+			expected, err := c.expected.Do()
+			test.CheckNoError(t, err)
+			if actual, expected := test.CursorKeys(t, crs), test.CursorKeys(t, expected); !reflect.DeepEqual(actual, expected) || len(expected) == 0 {
+				t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+			}
+		})
+	}
+	t.Run("resume from", func(t *testing.T) {
+		crs, err := run(t, &crud.Query{})
+		test.CheckNoError(t, err)
+		crs.Next()
+		crs.Next()
+		resumed, err := run(t, &crud.Query{ResumeFrom: crs.NextKey()})
+		test.CheckNoError(t, err)
+		if actual, expected := test.CursorKeys(t, resumed), test.CursorKeys(t, crs); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+		}
+	})
+
+	bad := map[string]*crud.Query{
+		"nil query": nil,
+		"empty conjunction": {Conjunctions: []*crud.Conjunction{{}, {Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_EQUAL, "a1"),
+		}}}},
+		"unspecified operator": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_UNSPECIFIED, "a1"),
+		}}}},
+		"missing value": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_BETWEEN, "a1"),
+		}}}},
+		"value of exists": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_EXISTS, "a1"),
+		}}}},
+		"empty in": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_IN),
+		}}}},
+		"inverted between": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			clause(test.IndexID_A, crud.Operator_OPERATOR_BETWEEN, "b", "a"),
+		}}}},
+		"index id overflow": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			{IndexId: 0x100, Operator: crud.Operator_OPERATOR_EQUAL, Values: [][]byte{[]byte("a1")}},
+		}}}},
+		"components without composite": {Conjunctions: []*crud.Conjunction{{Clauses: []*crud.Clause{
+			{IndexId: uint32(test.IndexID_A), Operator: crud.Operator_OPERATOR_EQUAL, Values: [][]byte{[]byte("a1")}, Components: [][]byte{[]byte("c")}},
+		}}}},
+		"order by overflow": {OrderBy: &crud.OrderBy{IndexId: 0x100}},
+		"empty range":       {Start: 2, End: 2},
+	}
+	for name, q := range bad {
+		t.Run("bad argument/"+name, func(t *testing.T) {
+			if _, err := s.QueryFrom(q); !errors.Is(err, crud.ErrBadArgument) {
+				t.Fatal("unexpected error", err)
+			}
+		})
+	}
+}
+
+func Test_singleResult(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+
+	// pk reads the object with the given read method and returns its primary key
+	pk := func(t *testing.T, read func(o crud.Object) error) string {
+		obj := test.NewObject()
+		test.CheckNoError(t, read(obj))
+		return string(obj.PrimaryKey())
+	}
+
+	cases := map[string]struct {
+		query func() crud.ValidQuery
+		first string
+		one   error
+	}{
+		"equals": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_B).Equals([]byte("b4"))
+			},
+			first: "pk4",
+		},
+		"several": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1"))
+			},
+			first: "pk1",
+			one:   crud.ErrMultipleResults,
+		},
+		"several/descending": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).Descending()
+			},
+			first: "pk7",
+			one:   crud.ErrMultipleResults,
+		},
+		"range": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).WithRange().Start(2).End(3)
+			},
+			first: "pk7",
+		},
+		"exists": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_B).Exists().And().Index(test.IndexID_B).HasPrefix([]byte("b9"))
+			},
+			first: "pk9",
+		},
+		"conjunctions": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_A).Equals([]byte("a0")).
+					AndNot().Index(test.IndexID_B).In([]byte("b0"), []byte("b3"), []byte("b6"))
+			},
+			first: "pk9",
+		},
+		"filter": {
+			query: func() crud.ValidQuery {
+				return s.Query().Where().Index(test.IndexID_B).Exists().Filter(func() crud.Object { return test.NewObject() }, func(o crud.Object) bool {
+					return string(o.PrimaryKey()) > "pk7"
+				})
+			},
+			first: "pk8",
+			one:   crud.ErrMultipleResults,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := pk(t, c.query().First); actual != c.first {
+				t.Fatalf("unexpected first object (expected : %s, actual : %s)", c.first, actual)
+			}
+			obj := test.NewObject()
+			err := c.query().One(obj)
+			if c.one != nil {
+				if !errors.Is(err, c.one) {
+					t.Fatal("unexpected error", err)
+				}
+				return
+			}
+			test.CheckNoError(t, err)
+			if actual := string(obj.PrimaryKey()); actual != c.first {
+				t.Fatalf("unexpected object (expected : %s, actual : %s)", c.first, actual)
+			}
+		})
+	}
+	t.Run("not found", func(t *testing.T) {
+		q := func() crud.ValidQuery { return s.Query().Where().Index(test.IndexID_A).Equals([]byte("a3")) }
+		if err := q().First(test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := q().One(test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("bad argument", func(t *testing.T) {
+		q := func() crud.ValidQuery {
+			return s.Query().Where().Index(test.IndexID_A).Between([]byte("a2"), []byte("a1"))
+		}
+		if err := q().First(test.NewObject()); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := q().One(test.NewObject()); !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("must one", func(t *testing.T) {
+		obj := test.NewObject()
+		s.Query().Where().Index(test.IndexID_B).Equals([]byte("b2")).MustOne(obj)
+		if string(obj.PrimaryKey()) != "pk2" {
+			t.Fatal("unexpected object", string(obj.PrimaryKey()))
+		}
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, crud.ErrMultipleResults) {
+				t.Fatal("unexpected panic", err)
+			}
+		}()
+		s.Query().Where().Index(test.IndexID_A).Equals([]byte("a2")).MustOne(test.NewObject())
+	})
+}
+
+func Test_corruptedIndex(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+	// the index list of pk0, the first object in the order of index A, cannot be decoded
+	prefix.NewStore(db, []byte{IndexesPrefix, 0x1}).Set([]byte("pk0"), []byte{0xFF})
+	q := func() crud.ValidQuery {
+		return s.Query().OrderBy(test.IndexID_A)
+	}
+
+	crs, err := q().Do()
+	test.CheckNoError(t, err)
+	if crs.Valid() {
+		t.Fatal("the cursor should have stopped")
+	}
+	if err := crs.Error(); !errors.Is(err, crud.ErrInternal) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := q().First(test.NewObject()); !errors.Is(err, crud.ErrInternal) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := q().One(test.NewObject()); !errors.Is(err, crud.ErrInternal) {
+		t.Fatal("unexpected error", err)
+	}
+	if _, err := q().Count(); !errors.Is(err, crud.ErrInternal) {
+		t.Fatal("unexpected error", err)
+	}
+	if _, err := crud.Paginate(q(), nil, func(crud.Cursor) error { return nil }); !errors.Is(err, crud.ErrInternal) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func Test_save(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil, WithUniqueIndexes(test.IndexID_B))
+
+	// count returns the number of objects with the given value for the index a
+	count := func(t *testing.T, a string) uint64 {
+		n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte(a)).Count()
+		test.CheckNoError(t, err)
+		return n
+	}
+
+	t.Run("create", func(t *testing.T) {
+		obj := test.NewCustomObject("pk1", "a1", "b1")
+		created, err := s.Save(obj)
+		test.CheckNoError(t, err)
+		if !created {
+			t.Fatal("the object should have been created")
+		}
+		actual := test.NewObject()
+		test.CheckNoError(t, s.Read([]byte("pk1"), actual))
+		if err := actual.Equals(&obj); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, "a1"); n != 1 {
+			t.Fatal("unexpected count", n)
+		}
+	})
+	t.Run("update", func(t *testing.T) {
+		obj := test.NewCustomObject("pk1", "a2", "b1")
+		created, err := s.Save(obj)
+		test.CheckNoError(t, err)
+		if created {
+			t.Fatal("the object should have been updated")
+		}
+		actual := test.NewObject()
+		test.CheckNoError(t, s.Read([]byte("pk1"), actual))
+		if err := actual.Equals(&obj); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, "a1"); n != 0 {
+			t.Fatal("the previous index value should have been removed", n)
+		}
+		if n := count(t, "a2"); n != 1 {
+			t.Fatal("unexpected count", n)
+		}
+		if n, err := s.Query().Count(); err != nil || n != 1 {
+			t.Fatal("unexpected object count", n, err)
+		}
+	})
+	t.Run("unique violation", func(t *testing.T) {
+		created, err := s.Save(test.NewCustomObject("pk2", "a2", "b1"))
+		if !errors.Is(err, crud.ErrUniqueViolation) || created {
+			t.Fatal("unexpected result", created, err)
+		}
+		if err := s.Read([]byte("pk2"), test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("the object should not have been created", err)
+		}
+		test.CheckNoError(t, s.Create(test.NewCustomObject("pk2", "a2", "b2")))
+		if _, err := s.Save(test.NewCustomObject("pk2", "a2", "b1")); !errors.Is(err, crud.ErrUniqueViolation) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("gas", func(t *testing.T) {
+		// saving costs what creating or updating costs, the object is looked for once
+		ctx, key, cdc, err := test.New()
+		test.CheckNoError(t, err)
+		saved, other := NewStore(cdc, ctx.KVStore(key), []byte("s1")), NewStore(cdc, ctx.KVStore(key), []byte("s2"))
+		gas := func(fn func() error) uint64 {
+			before := ctx.GasMeter().GasConsumed()
+			test.CheckNoError(t, fn())
+			return ctx.GasMeter().GasConsumed() - before
+		}
+		for _, obj := range []test.Object{test.NewCustomObject("pk1", "a1", "b1"), test.NewCustomObject("pk1", "a2", "b1")} {
+			save := gas(func() error {
+				_, err := saved.Save(obj)
+				return err
+			})
+			operation := other.Create
+			if other.objects.Has(obj.PrimaryKey()) {
+				operation = other.Update
+			}
+			if expected := gas(func() error { return operation(obj) }); save != expected {
+				t.Fatalf("unexpected gas for %s (expected : %d, actual : %d)", obj.PrimaryKey(), expected, save)
+			}
+		}
+	})
+}
+
+func Test_modify(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil)
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk1", "a1", "b1")))
+
+	// check reads the object pk1 and compares it to the expected one
+	check := func(t *testing.T, expected test.Object) {
+		actual := test.NewObject()
+		test.CheckNoError(t, s.Read([]byte("pk1"), actual))
+		if err := actual.Equals(&expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		obj := test.NewObject()
+		err := s.Modify([]byte("pk1"), obj, func(o crud.Object) error {
+			o.(*test.Object).TestSecondaryKeyA = []byte("a2")
+			return nil
+		})
+		test.CheckNoError(t, err)
+		check(t, test.NewCustomObject("pk1", "a2", "b1"))
+		if n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1")).Count(); err != nil || n != 0 {
+			t.Fatal("the previous index value should have been removed", n, err)
+		}
+		if n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("a2")).Count(); err != nil || n != 1 {
+			t.Fatal("unexpected count", n, err)
+		}
+	})
+	t.Run("not found", func(t *testing.T) {
+		err := s.Modify([]byte("pk2"), test.NewObject(), func(o crud.Object) error {
+			t.Fatal("fn should not be called")
+			return nil
+		})
+		if !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+	t.Run("fn error", func(t *testing.T) {
+		fnErr := errors.New("fn error")
+		err := s.Modify([]byte("pk1"), test.NewObject(), func(o crud.Object) error {
+			o.(*test.Object).TestSecondaryKeyA = []byte("a3")
+			return fnErr
+		})
+		if !errors.Is(err, fnErr) {
+			t.Fatal("unexpected error", err)
+		}
+		check(t, test.NewCustomObject("pk1", "a2", "b1"))
+	})
+	t.Run("primary key changed", func(t *testing.T) {
+		err := s.Modify([]byte("pk1"), test.NewObject(), func(o crud.Object) error {
+			o.(*test.Object).TestPrimaryKey = []byte("pk2")
+			return nil
+		})
+		if !errors.Is(err, crud.ErrBadArgument) {
+			t.Fatal("unexpected error", err)
+		}
+		check(t, test.NewCustomObject("pk1", "a2", "b1"))
+		if err := s.Read([]byte("pk2"), test.NewObject()); !errors.Is(err, crud.ErrNotFound) {
+			t.Fatal("the object should not have been created", err)
+		}
+	})
+}
+
+// failingCodec is a codec whose marshalling or unmarshalling call of the given number fails
+type failingCodec struct {
+	codec.Codec
+	// calls is the number of calls made so far
+	calls int
+	// failAt is the number of the failing call, 0 for none
+	failAt int
+}
+
+func (c *failingCodec) call() error {
+	c.calls++
+	if c.calls == c.failAt {
+		return errors.New("codec failure")
+	}
+	return nil
+}
+
+func (c *failingCodec) MarshalLengthPrefixed(o codec.ProtoMarshaler) ([]byte, error) {
+	if err := c.call(); err != nil {
+		return nil, err
+	}
+	return c.Codec.MarshalLengthPrefixed(o)
+}
+
+func (c *failingCodec) UnmarshalLengthPrefixed(bz []byte, ptr codec.ProtoMarshaler) error {
+	if err := c.call(); err != nil {
+		return err
+	}
+	return c.Codec.UnmarshalLengthPrefixed(bz, ptr)
+}
+
+// snapshot returns the content of the kv store
+func snapshot(db sdk.KVStore) map[string]string {
+	content := make(map[string]string)
+	it := db.Iterator(nil, nil)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		content[string(it.Key())] = string(it.Value())
+	}
+	return content
+}
+
+// newStoreWithTwoObjects returns a ranked store whose index B is unique, holding the objects pk1 and pk2,
+// along with its kv store and its codec, which can be told to fail
+func newStoreWithTwoObjects(t *testing.T) (Store, sdk.KVStore, *failingCodec) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &failingCodec{Codec: cdc}
+	s := NewStore(failing, db, nil, WithRanks(), WithUniqueIndexes(test.IndexID_B))
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk1", "a1", "b1")))
+	test.CheckNoError(t, s.Create(test.NewCustomObject("pk2", "a1", "b2")))
+	return s, db, failing
+}
+
+func Test_atomic(t *testing.T) {
+	operations := map[string]func(s Store) error{
+		"create": func(s Store) error {
+			return s.Create(test.NewCustomObject("pk3", "a2", "b3"))
+		},
+		"update": func(s Store) error {
+			return s.Update(test.NewCustomObject("pk1", "a2", "b3"))
+		},
+		"delete": func(s Store) error {
+			return s.Delete([]byte("pk1"))
+		},
+		"save": func(s Store) error {
+			_, err := s.Save(test.NewCustomObject("pk2", "a2", "b2"))
+			return err
+		},
+		"modify": func(s Store) error {
+			return s.Modify([]byte("pk2"), test.NewObject(), func(o crud.Object) error {
+				o.(*test.Object).TestSecondaryKeyB = []byte("b3")
+				return nil
+			})
+		},
+	}
+	for name, operation := range operations {
+		t.Run("codec failure/"+name, func(t *testing.T) {
+			// fail each codec call of the operation in turn, until it succeeds
+			for n := 1; ; n++ {
+				s, db, failing := newStoreWithTwoObjects(t)
+				expected := snapshot(db)
+				failing.calls, failing.failAt = 0, n
+				err := operation(s)
+				if failing.calls < n {
+					test.CheckNoError(t, err)
+					if n == 1 {
+						t.Fatal("the operation should use the codec")
+					}
+					break
+				}
+				// the codec errors can be wrapped as crud.ErrInternal
+				if err == nil {
+					t.Fatalf("the failure of call %d should have been returned", n)
+				}
+				if actual := snapshot(db); !reflect.DeepEqual(actual, expected) {
+					t.Fatalf("the store should not have changed after the failure of call %d", n)
+				}
+			}
+		})
+	}
+
+	// the object pk1 is removed behind the store, so that the last step of the operations fails
+	inconsistent := map[string]func(s Store) error{
+		"update": func(s Store) error {
+			return s.Update(test.NewCustomObject("pk1", "a2", "b3"))
+		},
+		"delete": func(s Store) error {
+			return s.Delete([]byte("pk1"))
+		},
+	}
+	for name, operation := range inconsistent {
+		t.Run("object failure/"+name, func(t *testing.T) {
+			s, db, _ := newStoreWithTwoObjects(t)
+			prefix.NewStore(db, []byte{ObjectsPrefix}).Delete([]byte("pk1"))
+			expected := snapshot(db)
+			if err := operation(s); !errors.Is(err, crud.ErrNotFound) {
+				t.Fatal("unexpected error", err)
+			}
+			if actual := snapshot(db); !reflect.DeepEqual(actual, expected) {
+				t.Fatal("the store should not have changed")
+			}
+		})
+	}
+}
+
+func Test_batch(t *testing.T) {
+	// objects returns test objects whose primary key and index values are built from the given triplets
+	objects := func(values ...[3]string) []crud.Object {
+		objs := make([]crud.Object, len(values))
+		for i, v := range values {
+			objs[i] = test.NewCustomObject(v[0], v[1], v[2])
+		}
+		return objs
+	}
+
+	t.Run("success", func(t *testing.T) {
+		s, _, _ := newStoreWithTwoObjects(t)
+		test.CheckNoError(t, s.CreateMany(objects([3]string{"pk3", "a2", "b3"}, [3]string{"pk4", "a2", "b4"})))
+		test.CheckNoError(t, s.UpdateMany(objects([3]string{"pk1", "a2", "b5"}, [3]string{"pk3", "a1", "b1"})))
+		test.CheckNoError(t, s.DeleteMany([][]byte{[]byte("pk2"), []byte("pk4")}))
+		test.CheckNoError(t, s.CreateMany(nil))
+
+		for pk, expected := range map[string]test.Object{
+			"pk1": test.NewCustomObject("pk1", "a2", "b5"),
+			"pk3": test.NewCustomObject("pk3", "a1", "b1"),
+		} {
+			actual := test.NewObject()
+			test.CheckNoError(t, s.Read([]byte(pk), actual))
+			if err := actual.Equals(&expected); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n, err := s.Query().Count(); err != nil || n != 2 {
+			t.Fatal("unexpected object count", n, err)
+		}
+		if n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("a2")).Count(); err != nil || n != 1 {
+			t.Fatal("unexpected index count", n, err)
+		}
+	})
+
+	cases := map[string]struct {
+		operation func(s Store) error
+		index     int
+		err       error
+	}{
+		"create/nil object": {
+			operation: func(s Store) error {
+				return s.CreateMany(append(objects([3]string{"pk3", "a2", "b3"}), nil))
+			},
+			index: 1,
+			err:   crud.ErrBadArgument,
+		},
+		"create/duplicated primary key": {
+			operation: func(s Store) error {
+				return s.CreateMany(objects([3]string{"pk3", "a2", "b3"}, [3]string{"pk4", "a2", "b4"}, [3]string{"pk3", "a2", "b5"}))
+			},
+			index: 2,
+			err:   crud.ErrBadArgument,
+		},
+		"create/already exists": {
+			operation: func(s Store) error {
+				return s.CreateMany(objects([3]string{"pk3", "a2", "b3"}, [3]string{"pk2", "a2", "b4"}))
+			},
+			index: 1,
+			err:   crud.ErrAlreadyExists,
+		},
+		"create/unique violation in batch": {
+			operation: func(s Store) error {
+				return s.CreateMany(objects([3]string{"pk3", "a2", "b3"}, [3]string{"pk4", "a2", "b3"}))
+			},
+			index: 1,
+			err:   crud.ErrUniqueViolation,
+		},
+		"update/not found": {
+			operation: func(s Store) error {
+				return s.UpdateMany(objects([3]string{"pk1", "a2", "b3"}, [3]string{"pk3", "a2", "b4"}))
+			},
+			index: 1,
+			err:   crud.ErrNotFound,
+		},
+		"update/unique violation": {
+			operation: func(s Store) error {
+				return s.UpdateMany(objects([3]string{"pk1", "a2", "b3"}, [3]string{"pk2", "a2", "b3"}))
+			},
+			index: 1,
+			err:   crud.ErrUniqueViolation,
+		},
+		"delete/not found": {
+			operation: func(s Store) error {
+				return s.DeleteMany([][]byte{[]byte("pk1"), []byte("pk3")})
+			},
+			index: 1,
+			err:   crud.ErrNotFound,
+		},
+		"delete/duplicated primary key": {
+			operation: func(s Store) error {
+				return s.DeleteMany([][]byte{[]byte("pk1"), []byte("pk2"), []byte("pk1")})
+			},
+			index: 2,
+			err:   crud.ErrBadArgument,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, db, _ := newStoreWithTwoObjects(t)
+			expected := snapshot(db)
+			err := c.operation(s)
+			if !errors.Is(err, c.err) {
+				t.Fatal("unexpected error", err)
+			}
+			var batchErr *crud.BatchError
+			if !errors.As(err, &batchErr) || batchErr.Index != c.index {
+				t.Fatalf("unexpected failing element (expected : %d, actual : %v)", c.index, err)
+			}
+			if actual := snapshot(db); !reflect.DeepEqual(actual, expected) {
+				t.Fatal("the store should not have changed")
+			}
+		})
+	}
+}
+
+func Test_rebuildIndexes(t *testing.T) {
+	db, cdc, err := test.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(cdc, db, nil, WithRanks())
+	for i := 0; i < 10; i++ {
+		test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))))
+	}
+	// the store is turned into one written by the first versions: the index keys are <id><little endian length><value>,
+	// the index lists hold them and there are no counters nor ranks
+	for _, p := range []byte{IndexesPrefix, MetadataPrefix, RanksPrefix} {
+		clearStore(prefix.NewStore(db, []byte{p}))
+	}
+	legacyIndexes := prefix.NewStore(db, []byte{IndexesPrefix})
+	for i := 0; i < 10; i++ {
+		obj := test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%3), fmt.Sprintf("b%d", i))
+		var list types.IndexList
+		for _, sk := range obj.SecondaryKeys() {
+			key := append([]byte{byte(sk.ID), byte(len(sk.Value)), 0}, sk.Value...)
+			legacyIndexes.Set(append(append([]byte{0x0}, key...), obj.PrimaryKey()...), []byte{})
+			list.Indexes = append(list.Indexes, key)
+		}
+		b, err := cdc.MarshalLengthPrefixed(&list)
+		test.CheckNoError(t, err)
+		legacyIndexes.Set(append([]byte{0x1}, obj.PrimaryKey()...), b)
+	}
+
+	test.CheckNoError(t, s.RebuildIndexes(func() crud.Object { return test.NewObject() }))
+
+	if actual, expected := test.QueryKeys(t, s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1"))), []string{"pk1", "pk4", "pk7"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+	}
+	if actual, expected := test.QueryKeys(t, s.Query().Where().Index(test.IndexID_B).GreaterThan([]byte("b7"))), []string{"pk8", "pk9"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+	}
+	// the ranks are rebuilt
+	if actual, expected := test.QueryKeys(t, s.Query().WithRange().Start(8).End(0)), []string{"pk8", "pk9"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+	}
+	// the counters are rebuilt
+	if n, err := s.Query().Count(); err != nil || n != 10 {
+		t.Fatal("unexpected object count", n, err)
+	}
+	if n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("a0")).Count(); err != nil || n != 4 {
+		t.Fatal("unexpected index count", n, err)
+	}
+	// the objects can be updated and deleted
+	test.CheckNoError(t, s.Update(test.NewCustomObject("pk0", "a1", "b0")))
+	test.CheckNoError(t, s.Delete([]byte("pk1")))
+	if actual, expected := test.QueryKeys(t, s.Query().Where().Index(test.IndexID_A).Equals([]byte("a1"))), []string{"pk0", "pk4", "pk7"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected primary keys (expected : %v, actual : %v)", expected, actual)
+	}
+
+	t.Run("missing counters", func(t *testing.T) {
+		db, cdc, err := test.NewStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewStore(cdc, db, nil)
+		for i := 0; i < 4; i++ {
+			test.CheckNoError(t, s.Create(test.NewCustomObject(fmt.Sprintf("pk%d", i), fmt.Sprintf("a%d", i%2), fmt.Sprintf("b%d", i))))
+		}
+		// the store is turned into one written before the counters were maintained
+		clearStore(prefix.NewStore(db, []byte{MetadataPrefix}))
+		if err := s.Delete([]byte("pk0")); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("unexpected error", err)
+		}
+		test.CheckNoError(t, s.RebuildIndexes(func() crud.Object { return test.NewObject() }))
+		test.CheckNoError(t, s.Delete([]byte("pk0")))
+		test.CheckNoError(t, s.Update(test.NewCustomObject("pk1", "a0", "b1")))
+		if n, err := s.Query().Count(); err != nil || n != 3 {
+			t.Fatal("unexpected object count", n, err)
+		}
+		if n, err := s.Query().Where().Index(test.IndexID_A).Equals([]byte("a0")).Count(); err != nil || n != 2 {
+			t.Fatal("unexpected index count", n, err)
+		}
+	})
+
+	t.Run("decode failure", func(t *testing.T) {
+		// an object which cannot be decoded
+		prefix.NewStore(db, []byte{ObjectsPrefix}).Set([]byte("pk9"), []byte{0xFF})
+		expected := snapshot(db)
+		if err := s.RebuildIndexes(func() crud.Object { return test.NewObject() }); !errors.Is(err, crud.ErrInternal) {
+			t.Fatal("unexpected error", err)
+		}
+		if actual := snapshot(db); !reflect.DeepEqual(actual, expected) {
+			t.Fatal("the store should not have changed")
+		}
+	})
+}